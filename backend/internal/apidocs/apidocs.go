@@ -0,0 +1,140 @@
+// Package apidocs holds the OpenAPI 3 document of the API. It is maintained
+// by hand in openapi.yaml next to the routes and served as JSON; Coverage
+// compares it with the routes the server registers, so a route cannot be
+// added without documenting it.
+package apidocs
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+//go:embed docs.html
+var docsHTML []byte
+
+// methods are the operations of an OpenAPI path item that gin can route
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// spec is the parsed document; the embedded file is checked when the binary starts
+var spec = mustParse(specYAML)
+
+// document is the part of the OpenAPI document needed to compare it with the routes
+type document struct {
+	Paths map[string]map[string]interface{} `json:"paths"`
+}
+
+type parsed struct {
+	json  []byte
+	paths document
+}
+
+func mustParse(data []byte) parsed {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		panic(fmt.Sprintf("invalid OpenAPI document: %v", err))
+	}
+	encoded, err := json.Marshal(stringKeys(raw))
+	if err != nil {
+		panic(fmt.Sprintf("invalid OpenAPI document: %v", err))
+	}
+
+	var doc document
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		panic(fmt.Sprintf("invalid OpenAPI document: %v", err))
+	}
+	return parsed{json: encoded, paths: doc}
+}
+
+// stringKeys converts the maps YAML decodes with non-string keys, such as
+// unquoted status codes, into maps JSON can encode
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = stringKeys(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return converted
+	case []interface{}:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+		return v
+	}
+	return value
+}
+
+// JSON returns the OpenAPI document as JSON
+func JSON() []byte {
+	return spec.json
+}
+
+// HTML returns a Redoc page that renders the document from /api/openapi.json
+func HTML() []byte {
+	return docsHTML
+}
+
+// Coverage compares the routes registered on the server with the document.
+// undocumented lists routes missing from the document, unrouted lists
+// documented operations no route serves; both as "METHOD /path" in OpenAPI
+// notation, e.g. "GET /api/events/{id}".
+func Coverage(routes gin.RoutesInfo) (undocumented, unrouted []string) {
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		operation := route.Method + " " + openAPIPath(route.Path)
+		registered[operation] = true
+		if !documented(route.Method, openAPIPath(route.Path)) {
+			undocumented = append(undocumented, operation)
+		}
+	}
+
+	for path, item := range spec.paths.Paths {
+		for _, method := range methods {
+			if _, ok := item[method]; !ok {
+				continue
+			}
+			operation := strings.ToUpper(method) + " " + path
+			if !registered[operation] {
+				unrouted = append(unrouted, operation)
+			}
+		}
+	}
+
+	sort.Strings(undocumented)
+	sort.Strings(unrouted)
+	return undocumented, unrouted
+}
+
+func documented(method, path string) bool {
+	item, ok := spec.paths.Paths[path]
+	if !ok {
+		return false
+	}
+	_, ok = item[strings.ToLower(method)]
+	return ok
+}
+
+// openAPIPath converts gin parameters such as :id or *path to {id} and {path}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
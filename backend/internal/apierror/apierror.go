@@ -0,0 +1,167 @@
+// Package apierror defines the errors the API answers with. Each carries an
+// HTTP status, a stable machine-readable code and a detail safe to show to
+// clients. Handlers add them to the request with c.Error, and
+// middleware.Errors writes them as RFC 7807 problems (application/problem+json).
+// The underlying cause, such as a database error, goes to the log only.
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// Codes identify the kind of error independently of the wording of the
+// detail; clients may rely on them
+const (
+	CodeBadRequest              = "bad_request"
+	CodeInvalidJSON             = "invalid_json"
+	CodeValidationFailed        = "validation_failed"
+	CodeUnauthorized            = "unauthorized"
+	CodeInvalidCredentials      = "invalid_credentials"
+	CodeInvalidToken            = "invalid_token"
+	CodeSessionRevoked          = "session_revoked"
+	CodeInvalidMFACode          = "invalid_mfa_code"
+	CodeForbidden               = "forbidden"
+	CodeInsufficientPermissions = "insufficient_permissions"
+	CodeSiteAccessDenied        = "site_access_denied"
+	CodeAPIKeyNotAllowed        = "api_key_not_allowed"
+	CodeMFARequired             = "mfa_required"
+	CodeNotFound                = "not_found"
+	CodeConflict                = "conflict"
+	CodeAlreadyExists           = "already_exists"
+	CodeRateLimited             = "rate_limited"
+	CodeInternal                = "internal_error"
+	CodeBadGateway              = "bad_gateway"
+	CodeUnavailable             = "service_unavailable"
+	CodeDatabaseUnavailable     = "database_unavailable"
+)
+
+// Error is an error response of the API
+type Error struct {
+	Status int
+	Code   string
+	// Detail explains the error to the client; it must not contain internals
+	Detail string
+	// Fields lists the invalid fields of a request body
+	Fields []FieldError
+	// Extensions are added to the problem, e.g. the missing permissions
+	Extensions map[string]interface{}
+	// Err is the cause; it is logged but never sent to the client
+	Err error
+}
+
+// New creates an error with the given status, code and detail
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// BadRequest reports a request the server cannot handle as sent
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+// Unauthorized reports missing or invalid authentication
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+// Forbidden reports an authenticated caller that may not do what it asked
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// NotFound reports a resource that does not exist
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// Conflict reports a request that clashes with the state of a resource
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+// TooManyRequests reports a caller that has to wait before trying again
+func TooManyRequests(detail string) *Error {
+	return New(http.StatusTooManyRequests, CodeRateLimited, detail)
+}
+
+// Internal reports a failure of the server. The client only sees detail;
+// err is logged.
+func Internal(detail string, err error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, detail).Wrap(err)
+}
+
+// Unavailable reports a dependency that is temporarily unavailable
+func Unavailable(detail string) *Error {
+	return New(http.StatusServiceUnavailable, CodeUnavailable, detail)
+}
+
+// Wrap records the cause of the error for the log
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// With adds a member to the problem, e.g. the values a field accepts
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]interface{})
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// Error describes the error for the log, including its cause
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Detail)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// From returns err as an API error. Errors that are not API errors become
+// internal errors that hide their message.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Internal("An unexpected error occurred", err)
+}
+
+// Problem renders the error as an RFC 7807 problem. instance is the path of
+// the request and requestID ties the response to the log lines.
+func (e *Error) Problem(instance, requestID string) map[string]interface{} {
+	problem := make(map[string]interface{}, len(e.Extensions)+8)
+	for key, value := range e.Extensions {
+		problem[key] = value
+	}
+	// Standard members win over extensions of the same name
+	problem["type"] = "about:blank"
+	problem["title"] = http.StatusText(e.Status)
+	problem["status"] = e.Status
+	problem["code"] = e.Code
+	if e.Detail != "" {
+		problem["detail"] = e.Detail
+	}
+	if instance != "" {
+		problem["instance"] = instance
+	}
+	if requestID != "" {
+		problem["request_id"] = requestID
+	}
+	if len(e.Fields) > 0 {
+		problem["errors"] = e.Fields
+	}
+	return problem
+}
@@ -0,0 +1,136 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes an invalid field of a request body
+type FieldError struct {
+	// Field is the JSON name, with the path for nested fields, e.g. scopes[0]
+	Field string `json:"field"`
+	// Code is the rule the field broke, named like its binding tag, e.g.
+	// required, email or min
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func init() {
+	// Name fields in validation errors like clients send them
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(jsonName)
+	}
+}
+
+// jsonName returns the name of a struct field in JSON
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// Invalid reports a single invalid field found by a check of the handler
+func Invalid(field, code, message string) *Error {
+	return &Error{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidationFailed,
+		Detail: fmt.Sprintf("%s %s", field, message),
+		Fields: []FieldError{{Field: field, Code: code, Message: message}},
+	}
+}
+
+// Validation translates an error of binding a request body, such as from
+// c.ShouldBindJSON, into a bad request listing the invalid fields
+func Validation(err error) *Error {
+	var fieldErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &fieldErrs):
+		fields := make([]FieldError, 0, len(fieldErrs))
+		for _, fe := range fieldErrs {
+			fields = append(fields, FieldError{Field: fieldPath(fe), Code: fe.Tag(), Message: message(fe)})
+		}
+		return &Error{
+			Status: http.StatusBadRequest,
+			Code:   CodeValidationFailed,
+			Detail: "The request has invalid fields",
+			Fields: fields,
+		}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return Invalid(typeErr.Field, "type", "must be "+typeName(typeErr.Type))
+	case errors.As(err, &timeErr):
+		return New(http.StatusBadRequest, CodeValidationFailed, "Timestamps must be in RFC 3339 format, e.g. 2024-05-01T18:00:00+02:00")
+	case errors.Is(err, io.EOF):
+		return New(http.StatusBadRequest, CodeInvalidJSON, "The request body is empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &typeErr):
+		return New(http.StatusBadRequest, CodeInvalidJSON, "The request body is not valid JSON of the expected shape")
+	}
+	return BadRequest("The request body is invalid").Wrap(err)
+}
+
+// fieldPath drops the name of the request struct from the namespace of a
+// field error, e.g. EventRequest.start_time becomes start_time
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+// message explains a broken validation rule
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a URL"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "min", "max", "len":
+		bound := map[string]string{"min": "at least", "max": "at most", "len": "exactly"}[fe.Tag()]
+		switch fe.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return fmt.Sprintf("must contain %s %s item(s)", bound, fe.Param())
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters long", bound, fe.Param())
+		}
+		return fmt.Sprintf("must be %s %s", bound, fe.Param())
+	}
+	return "is invalid"
+}
+
+// typeName names a Go type the way a JSON client would
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
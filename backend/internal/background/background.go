@@ -0,0 +1,64 @@
+// Package background runs work that outlives the request that started it,
+// such as notification emails, so that a shutdown can wait for it instead of
+// killing it halfway.
+package background
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"manage/internal/logging"
+)
+
+var (
+	tasks   sync.WaitGroup
+	running atomic.Int64
+
+	// ctx is canceled when Wait gives up on the remaining tasks
+	ctx, cancel = context.WithCancel(context.Background())
+
+	logger = logging.For("background")
+)
+
+// Go runs task in a goroutine that Wait waits for. The task's context keeps
+// the values of parent, such as the request ID, but is only canceled when the
+// shutdown deadline passes. A panic is logged instead of crashing the server.
+func Go(parent context.Context, name string, task func(ctx context.Context)) {
+	taskCtx, stop := context.WithCancel(context.WithoutCancel(parent))
+	stopOnShutdown := context.AfterFunc(ctx, stop)
+
+	tasks.Add(1)
+	running.Add(1)
+	go func() {
+		defer tasks.Done()
+		defer running.Add(-1)
+		defer stopOnShutdown()
+		defer stop()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.ErrorContext(taskCtx, "Background task panicked", "task", name, "panic", r)
+			}
+		}()
+		task(taskCtx)
+	}()
+}
+
+// Wait blocks until all tasks have finished or ctx is done. In the latter case
+// the remaining tasks are canceled and an error tells how many were running.
+func Wait(waitCtx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		tasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-waitCtx.Done():
+		cancel()
+		return fmt.Errorf("%d background task(s) still running: %w", running.Load(), waitCtx.Err())
+	}
+}
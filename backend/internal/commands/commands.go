@@ -0,0 +1,58 @@
+// Package commands implements the command-line subcommands of the backend binary.
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand invoked as "./main <name> [flags]"
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var registry = map[string]command{
+	"config": {
+		description: "Validate the configuration and print it with secrets redacted",
+		run:         PrintConfig,
+	},
+	"create-admin": {
+		description: "Create a local admin account",
+		run:         CreateAdmin,
+	},
+	"migrate": {
+		description: "Apply, revert, list or create database migrations",
+		run:         Migrate,
+	},
+	"openapi": {
+		description: "Print the OpenAPI document or check that it covers every route",
+		run:         OpenAPI,
+	},
+}
+
+// Run executes the named subcommand with the remaining arguments
+func Run(name string, args []string) error {
+	cmd, ok := registry[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n\n%s", name, Usage())
+	}
+	return cmd.run(args)
+}
+
+// Usage lists the available subcommands
+func Usage() string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Usage: main [command] [flags]\n\nRuns the API server when no command is given.\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-14s %s\n", name, registry[name].description)
+	}
+	return b.String()
+}
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+
+	"manage/internal/config"
+	"manage/internal/permissions"
+)
+
+// PrintConfig validates the configuration and prints the effective settings
+// with secrets redacted:
+//
+//	CONFIG_FILE=config.yaml ./main config
+func PrintConfig(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if _, err := permissions.LoadRoles(); err != nil {
+		return err
+	}
+
+	fmt.Print(cfg)
+	return nil
+}
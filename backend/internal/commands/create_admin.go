@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"manage/internal/config"
+	"manage/internal/permissions"
+	"manage/internal/repository"
+	"manage/internal/services"
+)
+
+// CreateAdmin creates a local admin account, e.g. the first one after a fresh install:
+//
+//	./main create-admin -email admin@example.com
+//
+// The admin gets the admin role of the given sites; -roles super_admin creates
+// one who manages all sites. The password is taken from -password, the ADMIN_PASSWORD variable, or read from stdin.
+func CreateAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := fs.String("email", "", "email address of the new admin (required)")
+	password := fs.String("password", "", "password; defaults to ADMIN_PASSWORD or a line read from stdin")
+	sites := fs.String("sites", config.Get().Site.ID, "comma-separated list of sites the admin manages")
+	roles := fs.String("roles", permissions.RoleAdmin, "comma-separated list of roles, e.g. super_admin for access to all sites")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" {
+		fs.Usage()
+		return fmt.Errorf("-email is required")
+	}
+	knownRoles := permissions.Default()
+	for _, role := range splitList(*roles) {
+		if _, ok := knownRoles[role]; !ok {
+			return fmt.Errorf("unknown role %q", role)
+		}
+	}
+
+	if *password == "" {
+		*password = os.Getenv("ADMIN_PASSWORD")
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	if err := config.InitDatabase(); err != nil {
+		return err
+	}
+	if config.GetDB() == nil {
+		return config.ErrDatabaseUnavailable
+	}
+
+	identity, err := services.NewLocalIdentityProvider(repository.NewPostgresUserRepository(config.GetDB)).CreateUser(
+		context.Background(), *email, *password, splitList(*roles), splitList(*sites),
+	)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created admin %s (%s)\n", identity.Email, identity.ID)
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
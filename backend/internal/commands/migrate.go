@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/migrate"
+	"manage/migrations"
+)
+
+// Migrate manages the database schema with the migrations embedded in the binary:
+//
+//	./main migrate up              apply all pending migrations
+//	./main migrate down [steps]    revert the newest migration, or the given number
+//	./main migrate status          list applied and pending migrations
+//	./main migrate create <name>   add empty migration files to -dir (default: migrations)
+func Migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := fs.String("dir", "migrations", "directory for new migrations (create only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: main migrate up|down [steps]|status|create <name>")
+	}
+
+	action, rest := fs.Arg(0), fs.Args()[1:]
+	if action == "create" {
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: main migrate create <name>")
+		}
+		up, down, err := migrate.Create(*dir, rest[0], time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\nCreated %s\n", up, down)
+		return nil
+	}
+
+	if action != "up" && action != "down" && action != "status" {
+		return fmt.Errorf("unknown migrate action %q, expected up, down, status or create", action)
+	}
+
+	if err := config.InitDatabase(); err != nil {
+		return err
+	}
+	if config.GetDB() == nil {
+		return config.ErrDatabaseUnavailable
+	}
+	migrator, err := migrate.New(config.GetDB(), migrations.FS)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(rest) > 0 {
+			if steps, err = strconv.Atoi(rest[0]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", rest[0])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Println("No migrations to revert")
+		}
+		return err
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema version: %d (latest: %d)\n", status.Current, status.Latest)
+		if status.Dirty {
+			fmt.Println("Schema is dirty: a migration failed halfway and must be repaired by hand")
+		}
+		for _, migration := range status.Applied {
+			fmt.Printf("  applied  %d_%s\n", migration.Version, migration.Name)
+		}
+		for _, migration := range status.Pending {
+			fmt.Printf("  pending  %d_%s\n", migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
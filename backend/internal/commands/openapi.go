@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"manage/internal/apidocs"
+	"manage/internal/config"
+	"manage/internal/routes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPI prints the OpenAPI document or checks it against the routes:
+//
+//	./main openapi print   write the document as JSON to stdout
+//	./main openapi check   fail if a route is missing from the document or a
+//	                       documented operation has no route
+//
+// The check registers the routes without connecting to the database, with
+// the optional ones such as /metrics enabled, so it can run in CI.
+func OpenAPI(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "print":
+		_, err := os.Stdout.Write(apidocs.JSON())
+		return err
+	case "check":
+	default:
+		return fmt.Errorf("usage: main openapi print|check")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	// Register the routes that are only served with a token, too
+	cfg.Health.Token = "openapi-check"
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	routes.SetupRoutes(r)
+	routes.SetupMetrics(r, config.MetricsConfig{Token: "openapi-check"})
+
+	undocumented, unrouted := apidocs.Coverage(r.Routes())
+	if len(undocumented) == 0 && len(unrouted) == 0 {
+		fmt.Printf("All %d routes are documented\n", len(r.Routes()))
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("OpenAPI document in internal/apidocs/openapi.yaml is out of date")
+	for _, operation := range undocumented {
+		fmt.Fprintf(&b, "\n  not documented: %s", operation)
+	}
+	for _, operation := range unrouted {
+		fmt.Fprintf(&b, "\n  no route:       %s", operation)
+	}
+	return errors.New(b.String())
+}
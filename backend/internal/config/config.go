@@ -0,0 +1,528 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"manage/internal/logging"
+	"manage/internal/tenancy"
+	"manage/internal/tracing"
+)
+
+// Profiles selected by GO_ENV
+const (
+	ProfileDevelopment = "development"
+	ProfileTest        = "test"
+	ProfileProduction  = "production"
+)
+
+// Reactions to an outdated schema at startup, selected by DB_SCHEMA_CHECK
+const (
+	SchemaCheckFail    = "fail"
+	SchemaCheckWarn    = "warn"
+	SchemaCheckMigrate = "migrate"
+)
+
+// devJWTSecret signs tokens outside production when JWT_SECRET is unset
+const devJWTSecret = "your-secret-key"
+
+// minProductionSecretLength is the shortest secret accepted in production
+const minProductionSecretLength = 32
+
+// redactedValue replaces secrets when the configuration is printed
+const redactedValue = "[redacted]"
+
+var logger = logging.For("config")
+
+// Config is the typed configuration of the backend. Each setting comes from
+// the environment variable in its env tag, else from the file named by
+// CONFIG_FILE under the key path of its yaml tags, else from its default.
+type Config struct {
+	// Env is the profile; production refuses the development fallbacks
+	Env      string         `yaml:"env" env:"GO_ENV" default:"development"`
+	Server   ServerConfig   `yaml:"server"`
+	Log      LogConfig      `yaml:"log"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Health   HealthConfig   `yaml:"health"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Auth0    Auth0Config    `yaml:"auth0"`
+	SMTP     SMTPConfig     `yaml:"smtp"`
+	Site     SiteConfig     `yaml:"site"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port              int           `yaml:"port" env:"PORT" default:"8080"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" default:"10s"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"30s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"2m"`
+	// DrainDelay is how long the server keeps serving after SIGTERM while
+	// readiness reports unhealthy, so load balancers stop sending requests
+	DrainDelay time.Duration `yaml:"drain_delay" env:"SERVER_DRAIN_DELAY" default:"5s"`
+	// ShutdownTimeout bounds the whole shutdown, including DrainDelay, in-flight
+	// requests and background tasks such as emails
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" default:"25s"`
+}
+
+// LogConfig configures the structured logs
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" default:"info"`
+	Format string `yaml:"format" env:"LOG_FORMAT" default:"json"`
+	// Levels overrides the level of single packages, e.g. gorm=debug
+	Levels []string `yaml:"levels" env:"LOG_LEVELS"`
+}
+
+// MetricsConfig decides where the Prometheus metrics are served. With Addr
+// they get their own listener, e.g. ":9090" reachable only inside the cluster;
+// otherwise /metrics is served on the main port to requests bearing Token.
+// Without either the endpoint is not served.
+type MetricsConfig struct {
+	Addr  string `yaml:"addr" env:"METRICS_ADDR"`
+	Token string `yaml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+// TracingConfig configures OpenTelemetry tracing. The OTLP exporter sends
+// traces over HTTP and also reads the standard OTEL_EXPORTER_OTLP_* variables
+// such as OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_EXPORTER_OTLP_HEADERS.
+type TracingConfig struct {
+	// Exporter is none, otlp, stdout or file
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER" default:"none"`
+	// File receives the spans as JSON lines with the file exporter
+	File        string `yaml:"file" env:"OTEL_TRACES_FILE" default:"traces.jsonl"`
+	ServiceName string `yaml:"service_name" env:"OTEL_SERVICE_NAME" default:"cc-lippstadt-backend"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1; traces
+	// started by a caller follow the caller's decision
+	SampleRatio float64 `yaml:"sample_ratio" env:"OTEL_TRACES_SAMPLER_ARG" default:"1"`
+}
+
+// HealthConfig configures the health checks of dependencies
+type HealthConfig struct {
+	// Token is required by /api/health/details, which is not served without it
+	Token string `yaml:"token" env:"HEALTH_TOKEN" secret:"true"`
+	// Timeout bounds a single check, CacheTTL is how long its result is reused
+	Timeout  time.Duration `yaml:"timeout" env:"HEALTH_CHECK_TIMEOUT" default:"2s"`
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"HEALTH_CACHE_TTL" default:"5s"`
+}
+
+// DatabaseConfig holds the PostgreSQL connection settings. Outside production
+// User and Password default to "postgres".
+type DatabaseConfig struct {
+	Host     string `yaml:"host" env:"DB_HOST" default:"localhost"`
+	Port     int    `yaml:"port" env:"DB_PORT" default:"5432"`
+	User     string `yaml:"user" env:"DB_USER"`
+	Password string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" env:"DB_NAME" default:"cc_lippstadt"`
+	SSLMode  string `yaml:"sslmode" env:"DB_SSLMODE" default:"disable"`
+	// SchemaCheck decides what happens when the server starts on an outdated
+	// schema: "fail" refuses to start, "warn" starts anyway and "migrate"
+	// applies the pending migrations
+	SchemaCheck string `yaml:"schema_check" env:"DB_SCHEMA_CHECK" default:"fail"`
+	// Connection pool limits
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"10"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+	// ConnectTimeout bounds establishing a connection, StatementTimeout aborts
+	// queries running longer on the server
+	ConnectTimeout   time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT" default:"5s"`
+	StatementTimeout time.Duration `yaml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT" default:"30s"`
+	// StartupTimeout is how long the server retries the first connection
+	// before it starts without the database and keeps retrying in the background
+	StartupTimeout time.Duration `yaml:"startup_timeout" env:"DB_STARTUP_TIMEOUT" default:"30s"`
+}
+
+// AuthConfig configures tokens, logins and the claims of Auth0 tokens
+type AuthConfig struct {
+	// IdentityProvider is "auth0" or "local"; it defaults to auth0 when an
+	// Auth0 domain is configured
+	IdentityProvider string `yaml:"identity_provider" env:"IDENTITY_PROVIDER"`
+	// JWTSecret signs the tokens issued by this API. Outside production it
+	// falls back to a well-known development value.
+	JWTSecret            string        `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	AccessTokenTTL       time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTokenTTL      time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" default:"720h"`
+	LoginLockoutDuration time.Duration `yaml:"login_lockout_duration" env:"LOGIN_LOCKOUT_DURATION" default:"15m"`
+	// MFAIssuer defaults to the organization name and MFAEncryptionKey to JWTSecret
+	MFAIssuer           string        `yaml:"mfa_issuer" env:"MFA_ISSUER"`
+	MFAEncryptionKey    string        `yaml:"mfa_encryption_key" env:"MFA_ENCRYPTION_KEY" secret:"true"`
+	MagicLinkURL        string        `yaml:"magic_link_url" env:"MAGIC_LINK_URL"`
+	MagicLinkTTL        time.Duration `yaml:"magic_link_ttl" env:"MAGIC_LINK_TTL" default:"15m"`
+	MagicLinkMaxPerHour int           `yaml:"magic_link_max_per_hour" env:"MAGIC_LINK_MAX_PER_HOUR" default:"3"`
+	InvitationURL       string        `yaml:"invitation_url" env:"INVITATION_URL"`
+	InvitationTTL       time.Duration `yaml:"invitation_ttl" env:"INVITATION_TTL" default:"168h"`
+	// ClaimsNamespace and the claim paths tell where tokens carry roles, sites
+	// and permissions; see middleware.ClaimsMapping
+	ClaimsNamespace   string   `yaml:"claims_namespace" env:"AUTH_CLAIMS_NAMESPACE"`
+	RolesClaims       []string `yaml:"roles_claims" env:"AUTH_ROLES_CLAIMS"`
+	SitesClaims       []string `yaml:"sites_claims" env:"AUTH_SITES_CLAIMS"`
+	PermissionsClaims []string `yaml:"permissions_claims" env:"AUTH_PERMISSIONS_CLAIMS" default:"permissions"`
+	// RolePermissions adds or overrides roles with a JSON object, e.g.
+	// {"youth_leader":["events:write"]}
+	RolePermissions string `yaml:"role_permissions" env:"ROLE_PERMISSIONS"`
+}
+
+// Auth0Config configures the Auth0 tenant used for logins and access tokens
+type Auth0Config struct {
+	// Domain is usually a bare host name; a full URL points at a local stand-in
+	Domain       string        `yaml:"domain" env:"AUTH0_DOMAIN"`
+	ClientID     string        `yaml:"client_id" env:"AUTH0_CLIENT_ID"`
+	ClientSecret string        `yaml:"client_secret" env:"AUTH0_CLIENT_SECRET" secret:"true"`
+	Connection   string        `yaml:"connection" env:"AUTH0_CONNECTION" default:"Username-Password-Authentication"`
+	Audience     string        `yaml:"audience" env:"AUTH0_AUDIENCE"`
+	Issuer       string        `yaml:"issuer" env:"AUTH0_ISSUER"`
+	JWKSURL      string        `yaml:"jwks_url" env:"AUTH0_JWKS_URL"`
+	UserCacheTTL time.Duration `yaml:"user_cache_ttl" env:"AUTH0_USER_CACHE_TTL" default:"1m"`
+	MaxAttempts  int           `yaml:"max_attempts" env:"AUTH0_MAX_ATTEMPTS" default:"3"`
+}
+
+// SMTPConfig configures outgoing email. Email is disabled without a host.
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT" default:"587"`
+	User     string `yaml:"user" env:"SMTP_USER"`
+	Password string `yaml:"password" env:"SMTP_PASS" secret:"true"`
+	// From defaults to User
+	From               string   `yaml:"from" env:"SMTP_FROM"`
+	NotificationEmails []string `yaml:"notification_emails" env:"NOTIFICATION_EMAILS"`
+}
+
+// SiteConfig describes the public website and the default site
+type SiteConfig struct {
+	// ID is the site of requests that name no other one
+	ID string `yaml:"id" env:"SITE_ID" default:"cc-lippstadt"`
+	// URL is the public website; outside production it defaults to the local frontend
+	URL              string        `yaml:"url" env:"SITE_URL"`
+	OrganizationName string        `yaml:"organization_name" env:"ORGANIZATION_NAME" default:"Calvary Chapel Lippstadt"`
+	CacheTTL         time.Duration `yaml:"cache_ttl" env:"SITE_CACHE_TTL" default:"1m"`
+}
+
+var (
+	current   *Config
+	currentMu sync.Mutex
+)
+
+// Load reads the configuration from the environment and CONFIG_FILE,
+// validates it and makes it the configuration returned by Get
+func Load() (*Config, error) {
+	cfg, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = cfg
+	return cfg, nil
+}
+
+// Get returns the configuration loaded at startup. Without a prior Load it is
+// loaded on first use, and an invalid configuration is fatal.
+func Get() *Config {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	if current == nil {
+		cfg, err := load()
+		if err != nil {
+			logger.Error("Invalid configuration", "error", err)
+			os.Exit(1)
+		}
+		current = cfg
+	}
+	return current
+}
+
+// IsProduction reports whether the production profile is active
+func (c *Config) IsProduction() bool {
+	return c.Env == ProfileProduction
+}
+
+// applyFallbacks fills settings that default to other settings. The
+// development fallbacks are skipped in production, where the settings must be
+// given explicitly.
+func (c *Config) applyFallbacks() {
+	if !c.IsProduction() {
+		if c.Auth.JWTSecret == "" {
+			c.Auth.JWTSecret = devJWTSecret
+		}
+		if c.Database.User == "" {
+			c.Database.User = "postgres"
+		}
+		if c.Database.Password == "" {
+			c.Database.Password = "postgres"
+		}
+		if c.Site.URL == "" {
+			c.Site.URL = "http://localhost:3000"
+		}
+	}
+
+	c.Site.URL = strings.TrimRight(c.Site.URL, "/")
+	if c.Auth.IdentityProvider == "" {
+		c.Auth.IdentityProvider = "local"
+		if c.Auth0.Domain != "" {
+			c.Auth.IdentityProvider = "auth0"
+		}
+	}
+	if c.Auth.MFAEncryptionKey == "" {
+		c.Auth.MFAEncryptionKey = c.Auth.JWTSecret
+	}
+	if c.Auth.MFAIssuer == "" {
+		c.Auth.MFAIssuer = c.Site.OrganizationName
+	}
+	if c.Auth.MagicLinkURL == "" && c.Site.URL != "" {
+		c.Auth.MagicLinkURL = c.Site.URL + "/admin/login/magic-link"
+	}
+	if c.Auth.InvitationURL == "" && c.Site.URL != "" {
+		c.Auth.InvitationURL = c.Site.URL + "/admin/invitations/accept"
+	}
+	if c.SMTP.From == "" {
+		c.SMTP.From = c.SMTP.User
+	}
+	if c.SMTP.From == "" {
+		c.SMTP.From = "noreply@cc-lippstadt.com"
+	}
+}
+
+// Validate checks every setting and returns all problems at once
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	switch c.Env {
+	case ProfileDevelopment, ProfileTest, ProfileProduction:
+	default:
+		problems = append(problems, fmt.Sprintf("GO_ENV must be %s, %s or %s, not %q",
+			ProfileDevelopment, ProfileTest, ProfileProduction, c.Env))
+	}
+
+	check(validPort(c.Server.Port), "PORT must be between 1 and 65535")
+	check(c.Server.DrainDelay < c.Server.ShutdownTimeout, "SERVER_DRAIN_DELAY must be shorter than SERVER_SHUTDOWN_TIMEOUT")
+
+	if c.Metrics.Addr != "" {
+		_, port, err := net.SplitHostPort(c.Metrics.Addr)
+		n, _ := strconv.Atoi(port)
+		check(err == nil && validPort(n), "METRICS_ADDR must be host:port or :port, not %q", c.Metrics.Addr)
+		check(err != nil || n != c.Server.Port, "METRICS_ADDR must not use the port of the server")
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		check(c.Tracing.File != "", "OTEL_TRACES_FILE is required for the file exporter")
+	default:
+		problems = append(problems, fmt.Sprintf("OTEL_TRACES_EXPORTER must be %s, %s, %s or %s, not %q",
+			tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterFile, c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "OTEL_TRACES_SAMPLER_ARG must be between 0 and 1")
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		problems = append(problems, "LOG_LEVEL: "+err.Error())
+	}
+	if _, err := logging.ParseLevels(c.Log.Levels); err != nil {
+		problems = append(problems, "LOG_LEVELS: "+err.Error())
+	}
+	check(c.Log.Format == logging.FormatJSON || c.Log.Format == logging.FormatText,
+		"LOG_FORMAT must be %s or %s, not %q", logging.FormatJSON, logging.FormatText, c.Log.Format)
+
+	check(c.Database.Host != "", "DB_HOST is required")
+	check(validPort(c.Database.Port), "DB_PORT must be between 1 and 65535")
+	check(c.Database.Name != "", "DB_NAME is required")
+	switch c.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		problems = append(problems, fmt.Sprintf("DB_SSLMODE %q is not a PostgreSQL sslmode", c.Database.SSLMode))
+	}
+	switch c.Database.SchemaCheck {
+	case SchemaCheckFail, SchemaCheckWarn, SchemaCheckMigrate:
+	default:
+		problems = append(problems, fmt.Sprintf("DB_SCHEMA_CHECK must be %s, %s or %s, not %q",
+			SchemaCheckFail, SchemaCheckWarn, SchemaCheckMigrate, c.Database.SchemaCheck))
+	}
+	check(c.Database.MaxOpenConns > 0, "DB_MAX_OPEN_CONNS must be at least 1")
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS")
+	check(c.Database.ConnectTimeout >= time.Second, "DB_CONNECT_TIMEOUT must be at least 1s")
+
+	switch c.Auth.IdentityProvider {
+	case "local":
+	case "auth0":
+		check(c.Auth0.Domain != "", "AUTH0_DOMAIN is required for the auth0 identity provider")
+		check(c.Auth0.ClientID != "", "AUTH0_CLIENT_ID is required for the auth0 identity provider")
+		check(c.Auth0.ClientSecret != "", "AUTH0_CLIENT_SECRET is required for the auth0 identity provider")
+	default:
+		problems = append(problems, fmt.Sprintf("IDENTITY_PROVIDER must be auth0 or local, not %q", c.Auth.IdentityProvider))
+	}
+	check(c.Auth.AccessTokenTTL < c.Auth.RefreshTokenTTL, "ACCESS_TOKEN_TTL must be shorter than REFRESH_TOKEN_TTL")
+	check(c.Auth.MagicLinkMaxPerHour >= 1, "MAGIC_LINK_MAX_PER_HOUR must be at least 1")
+	check(c.Auth.RolePermissions == "" || json.Valid([]byte(c.Auth.RolePermissions)), "ROLE_PERMISSIONS must be a JSON object")
+	check(c.Auth0.MaxAttempts >= 1, "AUTH0_MAX_ATTEMPTS must be at least 1")
+
+	check(c.SMTP.Host == "" || validPort(c.SMTP.Port), "SMTP_PORT must be between 1 and 65535")
+	for _, email := range c.SMTP.NotificationEmails {
+		_, err := mail.ParseAddress(email)
+		check(err == nil, "NOTIFICATION_EMAILS contains an invalid address %q", email)
+	}
+
+	check(tenancy.ValidSiteID(c.Site.ID), "SITE_ID must consist of lowercase letters, digits and dashes")
+	for _, setting := range [][2]string{
+		{"SITE_URL", c.Site.URL},
+		{"MAGIC_LINK_URL", c.Auth.MagicLinkURL},
+		{"INVITATION_URL", c.Auth.InvitationURL},
+		{"AUTH0_ISSUER", c.Auth0.Issuer},
+		{"AUTH0_JWKS_URL", c.Auth0.JWKSURL},
+	} {
+		check(setting[1] == "" || validURL(setting[1]), "%s must be an absolute http(s) URL", setting[0])
+	}
+
+	if c.IsProduction() {
+		problems = append(problems, c.productionProblems()...)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+}
+
+// productionProblems lists the settings that are unsafe in production: the
+// development fallbacks, example values copied from env.example and
+// unencrypted connections
+func (c *Config) productionProblems() []string {
+	var problems []string
+	secret := func(name, value string, required bool) {
+		switch {
+		case value == "":
+			if required {
+				problems = append(problems, name+" must be set in production")
+			}
+		case isPlaceholder(value):
+			problems = append(problems, name+" is still set to an example value")
+		case len(value) < minProductionSecretLength:
+			problems = append(problems, fmt.Sprintf("%s must be at least %d characters in production", name, minProductionSecretLength))
+		}
+	}
+
+	secret("JWT_SECRET", c.Auth.JWTSecret, true)
+	secret("METRICS_TOKEN", c.Metrics.Token, false)
+	secret("HEALTH_TOKEN", c.Health.Token, false)
+	if c.Auth.MFAEncryptionKey != c.Auth.JWTSecret {
+		secret("MFA_ENCRYPTION_KEY", c.Auth.MFAEncryptionKey, false)
+	}
+
+	if c.Database.User == "" {
+		problems = append(problems, "DB_USER must be set in production")
+	}
+	switch {
+	case c.Database.Password == "":
+		problems = append(problems, "DB_PASSWORD must be set in production")
+	case isPlaceholder(c.Database.Password):
+		problems = append(problems, "DB_PASSWORD is still set to an example value")
+	}
+	if c.Database.SSLMode == "disable" {
+		problems = append(problems, "DB_SSLMODE=disable is not allowed in production; use require or verify-full")
+	}
+
+	if c.Site.URL == "" {
+		problems = append(problems, "SITE_URL must be set in production")
+	} else if u, err := url.Parse(c.Site.URL); err == nil && (u.Scheme != "https" || isLocalHost(u.Hostname())) {
+		problems = append(problems, "SITE_URL must be a public https URL in production")
+	}
+
+	if c.Auth.IdentityProvider == "auth0" && isPlaceholder(c.Auth0.ClientSecret) {
+		problems = append(problems, "AUTH0_CLIENT_SECRET is still set to an example value")
+	}
+	if isPlaceholder(c.SMTP.Password) {
+		problems = append(problems, "SMTP_PASS is still set to an example value")
+	}
+	return problems
+}
+
+// Redacted returns a copy of the configuration whose secrets are replaced,
+// safe to print or log
+func (c Config) Redacted() Config {
+	redactSecrets(&c)
+	return c
+}
+
+// String renders the effective configuration as YAML with secrets redacted
+func (c Config) String() string {
+	return c.Redacted().toYAML()
+}
+
+// GoString keeps %#v from printing secrets
+func (c Config) GoString() string {
+	return c.String()
+}
+
+// BaseURL returns the URL of the Auth0 tenant: https:// and the domain, or
+// the domain itself when it is a full URL such as http://localhost:4000
+func (c Auth0Config) BaseURL() string {
+	baseURL := strings.TrimSuffix(c.Domain, "/")
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "https://" + baseURL
+	}
+	return baseURL
+}
+
+// DSN returns the connection string for the PostgreSQL driver, including the
+// connect and statement timeouts
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s connect_timeout=%d statement_timeout=%d",
+		d.Host, d.User, d.Password, d.Name, d.Port, d.SSLMode,
+		int(math.Ceil(d.ConnectTimeout.Seconds())), d.StatementTimeout.Milliseconds())
+}
+
+// URL returns the connection as a postgres:// URL, as used by migration tools
+func (d DatabaseConfig) URL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     fmt.Sprintf("%s:%d", d.Host, d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: "sslmode=" + url.QueryEscape(d.SSLMode),
+	}
+	return u.String()
+}
+
+// isPlaceholder reports whether a secret is one of the example values shipped
+// in the env.example files or the development fallback
+func isPlaceholder(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case devJWTSecret, "changeme", "change-me", "secret", "password", "postgres":
+		return true
+	}
+	return strings.HasPrefix(value, "your-")
+}
+
+// isLocalHost reports whether a host name points at the local machine
+func isLocalHost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1" || strings.HasSuffix(host, ".localhost")
+}
+
+// validPort reports whether port is a valid TCP port
+func validPort(port int) bool {
+	return port >= 1 && port <= 65535
+}
+
+// validURL reports whether value is an absolute http or https URL
+func validURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -1,8 +1,6 @@
 package config
 
 import (
-	"os"
-
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -17,7 +15,7 @@ func SetupCORS(r *gin.Engine) {
 		"http://frontend:3000",
 	}
 	
-	if siteURL := os.Getenv("SITE_URL"); siteURL != "" {
+	if siteURL := Get().Site.URL; siteURL != "" {
 		allowedOrigins = append(allowedOrigins, siteURL)
 	}
 	
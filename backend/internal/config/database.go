@@ -1,67 +1,294 @@
 package config
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"manage/internal/logging"
+	"manage/internal/models"
+	"manage/internal/tenancy"
+	"manage/internal/tracing"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// ErrDatabaseUnavailable is returned while the database cannot be reached
+var ErrDatabaseUnavailable = errors.New("database connection not available")
+
+const (
+	// monitorInterval is how often a reachable database is pinged
+	monitorInterval = 10 * time.Second
+	// Reconnection attempts back off exponentially between these delays
+	minRetryDelay = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+	// slowQueryThreshold is the duration from which queries are logged as slow
+	slowQueryThreshold = 200 * time.Millisecond
+)
+
+var (
+	// db is opened once; the pool reconnects by itself when the server is back
+	db        *gorm.DB
+	available atomic.Bool
+
+	hooksMu      sync.Mutex
+	connectHooks []func(ctx context.Context, db *gorm.DB) error
+
+	// recheck wakes the monitor early after a query failed with a connection error
+	recheck = make(chan struct{}, 1)
+)
 
-// InitDatabase initializes the database connection
-func InitDatabase() {
-	// Build DSN from individual environment variables
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "postgres")
-	dbName := getEnv("DB_NAME", "cc_lippstadt")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbSSLMode := getEnv("DB_SSLMODE", "disable")
+// OnDatabaseConnect registers a function that runs whenever the database
+// becomes reachable, before requests are served from it, e.g. the schema
+// check. Register hooks before InitDatabase.
+func OnDatabaseConnect(hook func(ctx context.Context, db *gorm.DB) error) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	connectHooks = append(connectHooks, hook)
+}
 
-	// Build PostgreSQL connection string
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-		dbHost, dbUser, dbPassword, dbName, dbPort, dbSSLMode)
+// InitDatabase opens the connection pool and waits up to DB_STARTUP_TIMEOUT
+// for the database, retrying with backoff. If it is still unreachable the
+// server starts without it and MonitorDatabase keeps reconnecting. Errors of
+// the connect hooks are returned.
+func InitDatabase() error {
+	cfg := Get().Database
+	opened, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logging.NewGormLogger(slowQueryThreshold),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
 
-	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	sqlDB, err := opened.DB()
 	if err != nil {
-		log.Printf("Failed to connect to database: %v", err)
-		// Don't exit, allow the app to start without DB for development
+		return err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	// Scope tenant data to the site of each request. Other tables with data of
+	// several sites are not tenant tables:
+	//   - audit_logs form one hash chain across all sites; entries carry the
+	//     site of their request and AuditService.List filters by it
+	//   - invitations may invite to several sites and are accepted by token on
+	//     any host; InvitationService filters them by their sites
+	//   - sessions and security_events belong to accounts and IP addresses,
+	//     which span sites. Sessions are only shown to their owner; security
+	//     events and lockouts need users:admin, which the built-in roles only
+	//     grant together with sites:admin.
+	tenantTables := []string{
+		models.ContactRequest{}.TableName(),
+		models.Event{}.TableName(),
+		models.APIKey{}.TableName(),
+	}
+	if err := tenancy.Register(opened, tenantTables...); err != nil {
+		return fmt.Errorf("failed to register tenant scopes: %w", err)
+	}
+	if err := registerAvailabilityCallbacks(opened); err != nil {
+		return fmt.Errorf("failed to register database callbacks: %w", err)
+	}
+	if err := tracing.RegisterGorm(opened); err != nil {
+		return fmt.Errorf("failed to register database tracing: %w", err)
+	}
+	db = opened
+
+	deadline := time.Now().Add(cfg.StartupTimeout)
+	for attempt := 1; ; attempt++ {
+		err := connect(context.Background())
+		if err == nil {
+			logger.Info("Database connected")
+			return nil
+		}
+		if !errors.Is(err, ErrDatabaseUnavailable) {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			logger.Warn("Database unreachable, starting without it and retrying in the background", "error", err)
+			return nil
+		}
+		logger.Warn("Database unreachable, retrying", "error", err, "attempt", attempt, "retry_in", delay.Round(time.Millisecond).String())
+		time.Sleep(delay)
+	}
+}
+
+// MonitorDatabase pings the database until ctx is done. It marks the database
+// unavailable when it stops answering and reconnects with backoff.
+func MonitorDatabase(ctx context.Context) {
+	if db == nil {
 		return
 	}
 
-	log.Println("Database connected successfully")
-	
-	// Auto-migrate models here when we add them
-	// DB.AutoMigrate(&models.User{})
+	attempt := 0
+	if !available.Load() {
+		attempt = 1
+	}
+	for {
+		wait := monitorInterval
+		if attempt > 0 {
+			wait = retryDelay(attempt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-recheck:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		wasAvailable := available.Load()
+		err := connect(ctx)
+		switch {
+		case err == nil:
+			if !wasAvailable {
+				logger.Info("Database connection restored")
+			}
+			attempt = 0
+		case ctx.Err() != nil:
+			return
+		default:
+			// Hook failures such as an outdated schema are logged on every
+			// attempt, unreachable databases only when the connection is lost
+			if wasAvailable || !errors.Is(err, ErrDatabaseUnavailable) {
+				logger.Error("Database unavailable, retrying in the background", "error", err)
+			}
+			attempt++
+		}
+	}
 }
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// connect pings the database and, when it was unavailable before, runs the
+// connect hooks before marking it available. Unreachable databases yield
+// ErrDatabaseUnavailable.
+func connect(ctx context.Context) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, Get().Database.ConnectTimeout)
+	defer cancel()
+	if err := sqlDB.PingContext(pingCtx); err != nil {
+		available.Store(false)
+		return fmt.Errorf("%w: %v", ErrDatabaseUnavailable, err)
 	}
-	return defaultValue
+	if available.Load() {
+		return nil
+	}
+
+	hooksMu.Lock()
+	hooks := append([]func(context.Context, *gorm.DB) error(nil), connectHooks...)
+	hooksMu.Unlock()
+	for _, hook := range hooks {
+		if err := hook(ctx, db.WithContext(ctx)); err != nil {
+			return err
+		}
+	}
+	available.Store(true)
+	return nil
+}
+
+// retryDelay returns the delay before the next connection attempt, growing
+// exponentially with jitter
+func retryDelay(attempt int) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 10 {
+		delay = min(minRetryDelay<<(attempt-1), maxRetryDelay)
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// registerAvailabilityCallbacks makes the monitor check the database right
+// away when a query fails with a connection error, so that following requests
+// are answered with 503 instead of failing one by one
+func registerAvailabilityCallbacks(db *gorm.DB) error {
+	check := func(tx *gorm.DB) {
+		if tx.Error != nil && IsConnectionError(tx.Error) {
+			select {
+			case recheck <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Query().After("gorm:query").Register("availability:query", check),
+		callbacks.Row().After("gorm:row").Register("availability:row", check),
+		callbacks.Raw().After("gorm:raw").Register("availability:raw", check),
+		callbacks.Create().After("gorm:create").Register("availability:create", check),
+		callbacks.Update().After("gorm:update").Register("availability:update", check),
+		callbacks.Delete().After("gorm:delete").Register("availability:delete", check),
+	)
+}
+
+// CloseDatabase closes the connection pool after the server has drained
+func CloseDatabase() error {
+	if db == nil {
+		return nil
+	}
+	available.Store(false)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// IsConnectionError reports whether err means the database could not be
+// reached, as opposed to a failed statement
+func IsConnectionError(err error) bool {
+	if errors.Is(err, ErrDatabaseUnavailable) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// DatabaseAvailable reports whether the database answered the last ping
+func DatabaseAvailable() bool {
+	return db != nil && available.Load()
 }
 
-// GetDatabaseURL builds a PostgreSQL connection URL from individual environment variables
+// GetDatabaseURL returns the PostgreSQL connection URL of the configured database
 // This is useful for migration tools that require a connection string
 func GetDatabaseURL() string {
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "postgres")
-	dbName := getEnv("DB_NAME", "cc_lippstadt")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbSSLMode := getEnv("DB_SSLMODE", "disable")
-
-	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		dbUser, dbPassword, dbHost, dbPort, dbName, dbSSLMode)
+	return Get().Database.URL()
 }
 
-// GetDB returns the database instance
+// GetDB returns the database instance, or nil while the database is unavailable
 func GetDB() *gorm.DB {
-	return DB
+	if !DatabaseAvailable() {
+		return nil
+	}
+	return db
+}
+
+// SQLDB returns the connection pool, also while the database is unavailable,
+// e.g. for its statistics; it is nil before InitDatabase
+func SQLDB() *sql.DB {
+	if db == nil {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil
+	}
+	return sqlDB
 }
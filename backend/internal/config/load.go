@@ -0,0 +1,251 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// load builds the configuration from defaults, CONFIG_FILE and the
+// environment, in increasing precedence, and validates it
+func load() (*Config, error) {
+	file := map[string]interface{}{}
+	path := os.Getenv("CONFIG_FILE")
+	if path != "" {
+		var err error
+		if file, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{}
+	loader := &loader{file: file, fileName: filepath.Base(path), used: map[string]bool{}}
+	loader.fill(reflect.ValueOf(cfg).Elem(), "")
+	loader.checkUnknownKeys(file, "")
+	if len(loader.problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(loader.problems, "\n  - "))
+	}
+
+	cfg.applyFallbacks()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile decodes a YAML or TOML configuration file, chosen by its extension
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// loader fills a Config from the environment and the decoded config file,
+// collecting every invalid value instead of stopping at the first
+type loader struct {
+	file     map[string]interface{}
+	fileName string
+	used     map[string]bool
+	problems []string
+}
+
+// fill sets the fields of a config struct; prefix is its key path in the file
+func (l *loader) fill(v reflect.Value, prefix string) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := prefix + field.Tag.Get("yaml")
+
+		if field.Type.Kind() == reflect.Struct {
+			l.used[key] = true
+			l.fill(v.Field(i), key+".")
+			continue
+		}
+
+		raw, source, ok := l.lookup(field, key)
+		if !ok {
+			continue
+		}
+		if err := setValue(v.Field(i), raw); err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s: %v", source, err))
+		}
+	}
+}
+
+// lookup returns the raw value of a setting and where it came from. Empty
+// environment variables count as unset, as in env.example.
+func (l *loader) lookup(field reflect.StructField, key string) (interface{}, string, bool) {
+	name := field.Tag.Get("env")
+	fileValue, inFile := lookupKey(l.file, key)
+	l.used[key] = inFile
+
+	if value := os.Getenv(name); value != "" {
+		return value, name, true
+	}
+	if inFile {
+		return fileValue, fmt.Sprintf("%s in %s", key, l.fileName), true
+	}
+	if value, ok := field.Tag.Lookup("default"); ok {
+		return value, "default of " + name, true
+	}
+	return nil, "", false
+}
+
+// checkUnknownKeys reports keys in the config file that match no setting,
+// which are usually typos
+func (l *loader) checkUnknownKeys(values map[string]interface{}, prefix string) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := prefix + key
+		if !l.used[path] {
+			l.problems = append(l.problems, fmt.Sprintf("%s in %s: unknown setting", path, l.fileName))
+			continue
+		}
+		if nested, ok := values[key].(map[string]interface{}); ok {
+			l.checkUnknownKeys(nested, path+".")
+		}
+	}
+}
+
+// lookupKey resolves a dot-separated key path in the decoded file
+func lookupKey(values map[string]interface{}, key string) (interface{}, bool) {
+	section, rest, nested := strings.Cut(key, ".")
+	if !nested {
+		value, ok := values[key]
+		return value, ok
+	}
+	if sub, ok := values[section].(map[string]interface{}); ok {
+		return lookupKey(sub, rest)
+	}
+	return nil, false
+}
+
+// setValue parses a raw value from the environment or the file into a field
+func setValue(field reflect.Value, raw interface{}) error {
+	if field.Kind() == reflect.Slice {
+		var list []string
+		switch value := raw.(type) {
+		case []interface{}:
+			for _, item := range value {
+				list = append(list, strings.TrimSpace(fmt.Sprint(item)))
+			}
+		case string:
+			list = splitList(value)
+		default:
+			return fmt.Errorf("expected a list, got %v", raw)
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+
+	switch raw.(type) {
+	case map[string]interface{}, []interface{}:
+		return fmt.Errorf("expected a single value, got %v", raw)
+	}
+	value := strings.TrimSpace(fmt.Sprint(raw))
+
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration %q, expected a positive value such as 15m or 24h", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// redactSecrets replaces the non-empty secret fields of a config struct
+func redactSecrets(v interface{}) {
+	redactValue(reflect.ValueOf(v).Elem())
+}
+
+func redactValue(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			redactValue(v.Field(i))
+		case field.Tag.Get("secret") == "true" && v.Field(i).String() != "":
+			v.Field(i).SetString(redactedValue)
+		}
+	}
+}
+
+// LogValue logs the configuration with secrets redacted and the keys of
+// config files
+func (c Config) LogValue() slog.Value {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(c.String()), &values); err != nil {
+		return slog.StringValue(c.String())
+	}
+	return slog.AnyValue(values)
+}
+
+// toYAML renders the configuration as YAML, in the format of config files
+func (c Config) toYAML() string {
+	var b strings.Builder
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return fmt.Sprintf("<invalid configuration: %v>", err)
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"manage/internal/apierror"
+	"manage/internal/permissions"
+	"manage/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyController lets admins manage API keys for scripts and integrations
+type APIKeyController struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyController creates a new API key controller
+func NewAPIKeyController(apiKeyService *services.APIKeyService) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// APIKeyRequest represents the request body for creating an API key
+type APIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// ExpiresAt is optional; keys without it never expire
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// GetAPIKeys returns all API keys without their secrets
+func (akc *APIKeyController) GetAPIKeys(c *gin.Context) {
+	keys, err := akc.apiKeyService.List(c.Request.Context())
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch API keys", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+	})
+}
+
+// CreateAPIKey creates an API key. The key is only included in this response.
+func (akc *APIKeyController) CreateAPIKey(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	var req APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	// Keys may only carry allowed scopes the creator holds themselves
+	granted := claims.EffectivePermissions()
+	for _, scope := range req.Scopes {
+		if !permissions.HasAll(permissions.APIKeyScopes, scope) {
+			c.Error(apierror.Invalid("scopes", "oneof", fmt.Sprintf("contains %q, which cannot be granted to API keys", scope)).
+				With("allowed", permissions.APIKeyScopes))
+			return
+		}
+		if !permissions.HasAll(granted, scope) {
+			c.Error(apierror.New(http.StatusForbidden, apierror.CodeInsufficientPermissions, fmt.Sprintf("You do not hold the scope %q yourself", scope)))
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.Error(apierror.Invalid("expires_at", "future", "must be in the future"))
+		return
+	}
+
+	apiKey, key, err := akc.apiKeyService.Create(c.Request.Context(), req.Name, req.Scopes, req.ExpiresAt, claims.Sub, c.ClientIP())
+	if err != nil {
+		c.Error(apierror.Internal("Failed to create API key", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKey,
+		"key":     key,
+		"message": "Store this key now; it cannot be shown again.",
+	})
+}
+
+// RevokeAPIKey disables an API key immediately
+func (akc *APIKeyController) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid API key ID"))
+		return
+	}
+
+	actor := ""
+	if claims, ok := currentClaims(c); ok {
+		actor = claims.Sub
+	}
+
+	err = akc.apiKeyService.Revoke(c.Request.Context(), uint(id), actor, c.ClientIP())
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		c.Error(apierror.NotFound("API key not found"))
+		return
+	}
+	if errors.Is(err, services.ErrAPIKeyRevoked) {
+		c.Error(apierror.Conflict("API key has already been revoked"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to revoke API key", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
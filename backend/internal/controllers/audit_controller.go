@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"manage/internal/apierror"
+	"manage/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditController lets the data protection officer review the audit log
+type AuditController struct {
+	auditService *services.AuditService
+}
+
+// NewAuditController creates a new audit controller
+func NewAuditController(auditService *services.AuditService) *AuditController {
+	return &AuditController{
+		auditService: auditService,
+	}
+}
+
+// GetAuditLogs returns the newest audit log entries. They can be filtered with
+// ?actor=, ?action=, ?target_type=, ?target_id=, ?from= and ?to= (RFC 3339),
+// and paged with ?before_id= and ?limit=.
+func (ac *AuditController) GetAuditLogs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.Error(apierror.BadRequest("limit must be between 1 and 1000"))
+		return
+	}
+
+	filter := services.AuditFilter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Limit:      limit,
+	}
+
+	for param, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.Error(apierror.BadRequest(param + " must be an RFC 3339 timestamp"))
+				return
+			}
+			*target = &t
+		}
+	}
+
+	if value := c.Query("before_id"); value != "" {
+		beforeID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.Error(apierror.BadRequest("Invalid before_id"))
+			return
+		}
+		filter.BeforeID = uint(beforeID)
+	}
+
+	entries, err := ac.auditService.List(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch audit log", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+	})
+}
+
+// VerifyAuditLog checks the hash chain of the audit log for tampering
+func (ac *AuditController) VerifyAuditLog(c *gin.Context) {
+	result, err := ac.auditService.Verify(c.Request.Context())
+	if err != nil {
+		c.Error(apierror.Internal("Failed to verify audit log", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
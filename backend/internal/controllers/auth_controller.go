@@ -1,27 +1,50 @@
 package controllers
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
+	"errors"
+	"math"
 	"net/http"
-	"net/url"
-	"os"
+	"strconv"
 	"time"
 
+	"manage/internal/apierror"
+	"manage/internal/background"
+	"manage/internal/config"
+	"manage/internal/metrics"
 	"manage/internal/middleware"
+	"manage/internal/permissions"
+	"manage/internal/repository"
+	"manage/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 // AuthController handles authentication-related endpoints
-type AuthController struct{}
+type AuthController struct {
+	identityProvider services.IdentityProvider
+	sessionService   *services.SessionService
+	loginThrottle    *services.LoginThrottleService
+	mfaService       *services.MFAService
+	magicLinks       *services.MagicLinkService
+}
 
-// NewAuthController creates a new auth controller
-func NewAuthController() *AuthController {
-	return &AuthController{}
+// NewAuthController creates a new auth controller; users holds the accounts
+// of the local identity provider
+func NewAuthController(users repository.UserRepository, sessionService *services.SessionService, loginThrottle *services.LoginThrottleService, mfaService *services.MFAService, magicLinks *services.MagicLinkService) *AuthController {
+	identityProvider, err := services.NewIdentityProvider(users)
+	if err != nil {
+		logger.Error("Identity provider unavailable", "error", err)
+	}
+	return &AuthController{
+		identityProvider: identityProvider,
+		sessionService:   sessionService,
+		loginThrottle:    loginThrottle,
+		mfaService:       mfaService,
+		magicLinks:       magicLinks,
+	}
 }
 
 // LoginRequest represents the login request body
@@ -30,381 +53,586 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// LoginResponse represents the login response
+// LoginResponse represents the login and refresh response
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         User   `json:"user"`
+	// RecoveryCodes are returned once, when 2FA enrollment completes during login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
 }
 
-// User represents a user
-type User struct {
-	ID    string   `json:"id"`
-	Email string   `json:"email"`
-	Role  string   `json:"role"`
-	Sites []string `json:"sites"`
+// MagicLinkRequest represents a request for a login link by email
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
 }
 
-// Auth0TokenResponse represents the response from Auth0 token endpoint
-type Auth0TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
+// MagicLinkVerifyRequest represents the token of a clicked login link
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" binding:"required"`
 }
 
-// Auth0User represents a user from Auth0 Management API
-type Auth0User struct {
-	UserID      string                 `json:"user_id"`
-	Email       string                 `json:"email"`
-	AppMetadata map[string]interface{} `json:"app_metadata"`
+// MFAChallengeResponse is returned by login when a second factor is needed
+type MFAChallengeResponse struct {
+	MFARequired bool `json:"mfa_required"`
+	// EnrollmentRequired is set when 2FA is enforced for the user's roles but
+	// not yet set up; the token can then be used with /api/auth/mfa/setup
+	EnrollmentRequired bool   `json:"mfa_enrollment_required"`
+	MFAToken           string `json:"mfa_token"`
+	ExpiresIn          int    `json:"expires_in"`
 }
 
-// Auth0Error represents an error from Auth0
-type Auth0Error struct {
-	Error            string `json:"error"`
-	ErrorDescription string `json:"error_description"`
+// MFARequest represents the second step of a login with two-factor authentication
+type MFARequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// RefreshRequest represents the refresh request body
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// User represents a user
+type User struct {
+	ID          string   `json:"id"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"`
+	Sites       []string `json:"sites"`
+	Permissions []string `json:"permissions"`
 }
 
 // Login handles custom login form submission
 func (ac *AuthController) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		c.Error(apierror.Validation(err))
 		return
 	}
 
-	// Get Auth0 configuration from environment
-	auth0Domain := os.Getenv("AUTH0_DOMAIN")
-	auth0ClientID := os.Getenv("AUTH0_CLIENT_ID")
-	auth0ClientSecret := os.Getenv("AUTH0_CLIENT_SECRET")
-
-	if auth0Domain == "" || auth0ClientID == "" || auth0ClientSecret == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Auth0 configuration missing"})
+	if ac.identityProvider == nil {
+		c.Error(apierror.Internal("Identity provider not configured", nil))
 		return
 	}
 
-	// Step 1: Authenticate with Auth0 using Resource Owner Password Grant
-	fmt.Printf("Attempting Auth0 authentication for user: %s\n", req.Email)
-	_, err := ac.authenticateWithAuth0(auth0Domain, auth0ClientID, auth0ClientSecret, req.Email, req.Password)
+	ctx := c.Request.Context()
+	ipAddress := c.ClientIP()
+
+	// Step 1: Refuse attempts while the account or IP is throttled
+	wait, err := ac.loginThrottle.Check(ctx, req.Email, ipAddress)
 	if err != nil {
-		fmt.Printf("❌ Auth0 authentication failed: %v\n", err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Authentication failed: %v", err)})
+		// Fail open: the identity provider still verifies the password
+		logger.WarnContext(c.Request.Context(), "Login throttle unavailable", "error", err)
+	} else if wait > 0 {
+		metrics.LoginAttempt(metrics.LoginThrottled)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.Error(apierror.TooManyRequests("Too many failed login attempts. Please try again later."))
 		return
 	}
-	fmt.Printf("✅ Auth0 authentication successful\n")
 
-	// Step 2: Get user information from Auth0 Management API
-	fmt.Printf("Fetching user details from Auth0 Management API...\n")
-	user, err := ac.getUserFromAuth0(auth0Domain, auth0ClientID, auth0ClientSecret, req.Email)
+	// Step 2: Authenticate with the identity provider
+	logger.DebugContext(ctx, "Attempting authentication", "provider", ac.identityProvider.Name())
+	user, err := ac.identityProvider.Authenticate(ctx, req.Email, req.Password)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		metrics.LoginAttempt(metrics.LoginInvalidCredentials)
+		logger.InfoContext(ctx, "Authentication failed", "error", err)
+		if err := ac.loginThrottle.RecordFailure(ctx, req.Email, ipAddress); err != nil {
+			logger.WarnContext(c.Request.Context(), "Failed to record failed login", "error", err)
+		}
+		c.Error(apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Authentication failed: invalid email or password"))
+		return
+	}
 	if err != nil {
-		fmt.Printf("❌ Failed to get user information: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get user information: %v", err)})
+		metrics.LoginAttempt(metrics.LoginError)
+		c.Error(apierror.New(http.StatusBadGateway, apierror.CodeBadGateway, "Authentication failed: the identity provider could not be reached").Wrap(err))
 		return
 	}
-	fmt.Printf("✅ User details fetched successfully: %+v\n", user)
+	logger.InfoContext(ctx, "Authentication successful", "user_id", user.ID)
 
 	// Step 3: Check if user has required permissions
-	fmt.Printf("Checking user permissions...\n")
 	if !ac.hasRequiredPermissions(user) {
-		fmt.Printf("❌ Access denied: User %s does not have required permissions\n", req.Email)
-		fmt.Printf("User app_metadata: %+v\n", user.AppMetadata)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: Insufficient permissions"})
+		metrics.LoginAttempt(metrics.LoginForbidden)
+		logger.WarnContext(ctx, "Access denied: missing required permissions", "user_id", user.ID)
+		c.Error(apierror.New(http.StatusForbidden, apierror.CodeInsufficientPermissions, "Access denied: Insufficient permissions"))
 		return
 	}
-	fmt.Printf("✅ User has required permissions\n")
 
-	// Step 4: Create our own JWT token
-	jwtToken, err := ac.createJWTToken(user)
+	// Step 4: Ask for the second factor if needed, otherwise start the session
+	ac.completeLogin(c, user)
+}
+
+// completeLogin finishes a login whose first factor succeeded: it asks for the
+// second factor when the user is enrolled or 2FA is enforced for their roles,
+// and otherwise starts a session and issues our own tokens
+func (ac *AuthController) completeLogin(c *gin.Context, user *services.Identity) {
+	ctx := c.Request.Context()
+
+	enrolled, err := ac.mfaService.IsEnrolled(ctx, user.ID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to check two-factor authentication", err))
+		return
+	}
+	required, err := ac.mfaService.IsRequired(ctx, user.Roles)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		c.Error(apierror.Internal("Failed to check two-factor authentication", err))
+		return
+	}
+	if enrolled || required {
+		mfaToken, err := createMFAToken(user)
+		if err != nil {
+			metrics.LoginAttempt(metrics.LoginError)
+			c.Error(apierror.Internal("Failed to create token", err))
+			return
+		}
+		metrics.LoginAttempt(metrics.LoginMFARequired)
+		c.JSON(http.StatusOK, MFAChallengeResponse{
+			MFARequired:        true,
+			EnrollmentRequired: !enrolled,
+			MFAToken:           mfaToken,
+			ExpiresIn:          int(mfaTokenTTL.Seconds()),
+		})
 		return
 	}
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: jwtToken,
-		User: User{
-			ID:    user.UserID,
-			Email: user.Email,
-			Role:  ac.getUserRole(user),
-			Sites: ac.getUserSites(user),
-		},
-	})
-}
+	// Failures are only forgotten now, so a known password cannot reset guessing of 2FA codes
+	if err := ac.loginThrottle.RecordSuccess(ctx, user.Email); err != nil {
+		logger.WarnContext(c.Request.Context(), "Failed to reset login throttle", "error", err)
+	}
 
-// Logout handles user logout
-func (ac *AuthController) Logout(c *gin.Context) {
-	auth0Domain := os.Getenv("AUTH0_DOMAIN")
-	clientID := os.Getenv("AUTH0_CLIENT_ID")
+	ac.startSession(c, user, nil)
+}
 
-	if auth0Domain == "" || clientID == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Auth0 configuration missing"})
+// RequestMagicLink emails a single-use login link. The response is the same
+// whether or not the address belongs to an account, and the lookup happens in
+// the background so the response time does not tell either.
+func (ac *AuthController) RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
 		return
 	}
 
-	// Build Auth0 logout URL
-	logoutURL := url.URL{
-		Scheme: "https",
-		Host:   auth0Domain,
-		Path:   "/v2/logout",
+	if ac.identityProvider == nil {
+		c.Error(apierror.Internal("Identity provider not configured", nil))
+		return
 	}
 
-	siteURL := os.Getenv("SITE_URL")
-	if siteURL == "" {
-		siteURL = "http://localhost:3000" // Default for local development
-	}
+	email, ipAddress := req.Email, c.ClientIP()
+	sent := metrics.EmailQueued()
+	background.Go(c.Request.Context(), "magic link", func(ctx context.Context) {
+		defer sent()
+		ac.sendMagicLink(ctx, email, ipAddress)
+	})
 
-	params := url.Values{}
-	params.Add("client_id", clientID)
-	params.Add("returnTo", siteURL)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If an account exists for this address, a login link has been sent.",
+	})
+}
 
-	logoutURL.RawQuery = params.Encode()
+// sendMagicLink looks up the account for the address and emails it a login link
+func (ac *AuthController) sendMagicLink(ctx context.Context, email, ipAddress string) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
-	c.Redirect(http.StatusTemporaryRedirect, logoutURL.String())
+	user, err := ac.identityProvider.LookupUser(ctx, email)
+	if errors.Is(err, services.ErrUserNotFound) {
+		logger.InfoContext(ctx, "Magic link requested for an unknown address")
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to look up user for magic link", "error", err)
+		return
+	}
+
+	if !ac.hasRequiredPermissions(user) {
+		logger.WarnContext(ctx, "Magic link not sent: missing required permissions", "user_id", user.ID)
+		return
+	}
+
+	err = ac.magicLinks.Send(ctx, user, ipAddress)
+	if errors.Is(err, services.ErrMagicLinkRateLimited) {
+		logger.WarnContext(ctx, "Magic link rate limit reached", "user_id", user.ID)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to send magic link", "error", err)
+		return
+	}
+	logger.InfoContext(ctx, "Magic link sent", "user_id", user.ID)
 }
 
-// Profile returns the current user's profile
-func (ac *AuthController) Profile(c *gin.Context) {
-	claims, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+// VerifyMagicLink exchanges a login link token for the session tokens, or for
+// a second factor challenge when the user has 2FA
+func (ac *AuthController) VerifyMagicLink(c *gin.Context) {
+	var req MagicLinkVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
 		return
 	}
 
-	// Convert claims to Auth0Claims type
-	auth0Claims, ok := claims.(*middleware.Auth0Claims)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
+	if ac.identityProvider == nil {
+		c.Error(apierror.Internal("Identity provider not configured", nil))
 		return
 	}
 
-	// Extract role and sites from app metadata
-	var role string
-	var sites []string
-	if auth0Claims.AppMetadata != nil {
-		if roleVal, ok := auth0Claims.AppMetadata["role"].(string); ok {
-			role = roleVal
-		}
-		if sitesVal, ok := auth0Claims.AppMetadata["sites"].([]interface{}); ok {
-			for _, site := range sitesVal {
-				if siteStr, ok := site.(string); ok {
-					sites = append(sites, siteStr)
-				}
-			}
-		}
+	ctx := c.Request.Context()
+	userID, email, err := ac.magicLinks.Consume(ctx, req.Token)
+	if errors.Is(err, services.ErrInvalidMagicLink) {
+		metrics.LoginAttempt(metrics.LoginInvalidCredentials)
+		c.Error(apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired login link"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to verify login link", err))
+		return
 	}
 
-	user := User{
-		ID:    auth0Claims.Sub,
-		Email: auth0Claims.Email,
-		Role:  role,
-		Sites: sites,
+	user, err := ac.lookupIdentity(ctx, userID, email)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.Error(apierror.Unauthorized("User no longer exists"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to get user information", err))
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	if !ac.hasRequiredPermissions(user) {
+		c.Error(apierror.New(http.StatusForbidden, apierror.CodeInsufficientPermissions, "Access denied: Insufficient permissions"))
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Magic link login", "user_id", user.ID)
+	ac.completeLogin(c, user)
 }
 
-// authenticateWithAuth0 authenticates user with Auth0 using Resource Owner Password Grant
-func (ac *AuthController) authenticateWithAuth0(domain, clientID, clientSecret, email, password string) (*Auth0TokenResponse, error) {
-	url := fmt.Sprintf("https://%s/oauth/token", domain)
+// CompleteMFA finishes a login with a TOTP code or a recovery code. Users who
+// had to enroll during login confirm their new authenticator here and receive
+// their recovery codes with the tokens.
+func (ac *AuthController) CompleteMFA(c *gin.Context) {
+	var req MFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.Error(apierror.Invalid("code", "required", "or recovery_code is required"))
+		return
+	}
 
-	payload := map[string]interface{}{
-		"grant_type":    "password",
-		"username":      email,
-		"password":      password,
-		"client_id":     clientID,
-		"client_secret": clientSecret,
-		"scope":         "openid profile email",
-		"realm":         "Username-Password-Authentication",
+	if ac.identityProvider == nil {
+		c.Error(apierror.Internal("Identity provider not configured", nil))
+		return
 	}
 
-	jsonData, err := json.Marshal(payload)
+	pending, err := parseMFAToken(req.MFAToken)
 	if err != nil {
-		return nil, err
+		c.Error(apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired two-factor token"))
+		return
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	ctx := c.Request.Context()
+	ipAddress := c.ClientIP()
+
+	// Codes are only six digits, so guessing is throttled like passwords
+	wait, err := ac.loginThrottle.Check(ctx, pending.Email, ipAddress)
 	if err != nil {
-		return nil, err
+		// Fail closed: unlike passwords, nothing else limits guessing here
+		c.Error(apierror.Unavailable("Two-factor verification is temporarily unavailable").Wrap(err))
+		return
+	}
+	if wait > 0 {
+		metrics.LoginAttempt(metrics.LoginThrottled)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.Error(apierror.TooManyRequests("Too many failed attempts. Please try again later."))
+		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	enrolled, err := ac.mfaService.IsEnrolled(ctx, pending.Sub)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to verify two-factor code", err))
+		return
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	var recoveryCodes []string
+	switch {
+	case enrolled && req.RecoveryCode != "":
+		err = ac.mfaService.VerifyRecoveryCode(ctx, pending.Sub, req.RecoveryCode, ipAddress)
+	case enrolled:
+		err = ac.mfaService.Verify(ctx, pending.Sub, req.Code)
+	default:
+		recoveryCodes, err = ac.mfaService.ConfirmEnrollment(ctx, pending.Sub, req.Code, ipAddress)
+	}
+	if errors.Is(err, services.ErrInvalidMFACode) {
+		metrics.LoginAttempt(metrics.LoginInvalidCredentials)
+		if err := ac.loginThrottle.RecordFailure(ctx, pending.Email, ipAddress); err != nil {
+			logger.WarnContext(c.Request.Context(), "Failed to record failed two-factor attempt", "error", err)
+		}
+		c.Error(apierror.New(http.StatusUnauthorized, apierror.CodeInvalidMFACode, "Invalid two-factor code"))
+		return
+	}
+	if errors.Is(err, services.ErrMFAEnrollmentNotStarted) {
+		c.Error(apierror.BadRequest("Two-factor enrollment has not been started"))
+		return
+	}
 	if err != nil {
-		return nil, err
+		c.Error(apierror.Internal("Failed to verify two-factor code", err))
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var auth0Err Auth0Error
-		json.NewDecoder(resp.Body).Decode(&auth0Err)
-		return nil, fmt.Errorf("auth0 error: %s", auth0Err.ErrorDescription)
+	if err := ac.loginThrottle.RecordSuccess(ctx, pending.Email); err != nil {
+		logger.WarnContext(c.Request.Context(), "Failed to reset login throttle", "error", err)
 	}
 
-	var tokenResp Auth0TokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, err
+	user, err := ac.lookupIdentity(ctx, pending.Sub, pending.Email)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.Error(apierror.Unauthorized("User no longer exists"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to get user information", err))
+		return
+	}
+
+	if !ac.hasRequiredPermissions(user) {
+		c.Error(apierror.New(http.StatusForbidden, apierror.CodeInsufficientPermissions, "Access denied: Insufficient permissions"))
+		return
 	}
 
-	return &tokenResp, nil
+	logger.InfoContext(c.Request.Context(), "Two-factor authentication successful", "user_id", user.ID)
+	ac.startSession(c, user, recoveryCodes)
 }
 
-// getUserFromAuth0 gets user information from Auth0 Management API
-func (ac *AuthController) getUserFromAuth0(domain, clientID, clientSecret, email string) (*Auth0User, error) {
-	// First get a Management API token
-	mgmtToken, err := ac.getManagementToken(domain, clientID, clientSecret)
+// startSession creates a login session for the user and responds with its
+// tokens; it completes a login attempt
+func (ac *AuthController) startSession(c *gin.Context, user *services.Identity, recoveryCodes []string) {
+	session, refreshToken, err := ac.sessionService.CreateSession(c.Request.Context(), user, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get management token: %w", err)
+		metrics.LoginAttempt(metrics.LoginError)
+		c.Error(apierror.Internal("Failed to create session", err))
+		return
 	}
 
-	// Then get user by email using Management API
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/api/v2/users-by-email?email=%s", domain, url.QueryEscape(email)), nil)
-	if err != nil {
-		return nil, err
+	metrics.LoginAttempt(metrics.LoginSuccess)
+	ac.respondWithTokens(c, user, session.ID, refreshToken, recoveryCodes)
+}
+
+// Refresh exchanges a refresh token for a new access token and refresh token.
+// Roles and sites are looked up again, so changes apply without a new login.
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
 	}
 
-	req.Header.Set("Authorization", "Bearer "+mgmtToken)
+	if ac.identityProvider == nil {
+		c.Error(apierror.Internal("Identity provider not configured", nil))
+		return
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	session, refreshToken, err := ac.sessionService.Refresh(c.Request.Context(), req.RefreshToken)
+	if errors.Is(err, services.ErrRefreshTokenReused) {
+		logger.WarnContext(c.Request.Context(), "Refresh token reuse detected, session revoked")
+		c.Error(apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Refresh token has already been used"))
+		return
+	}
+	if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrSessionRevoked) {
+		c.Error(apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired refresh token"))
+		return
+	}
 	if err != nil {
-		return nil, err
+		c.Error(apierror.Internal("Failed to refresh session", err))
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get user from Auth0: %s", string(body))
+	user, err := ac.lookupIdentity(c.Request.Context(), session.UserID, session.Email)
+	if errors.Is(err, services.ErrUserNotFound) {
+		ac.sessionService.RevokeSession(c.Request.Context(), session.UserID, session.ID, services.RevokedReasonUser)
+		c.Error(apierror.Unauthorized("User no longer exists"))
+		return
 	}
-
-	var users []Auth0User
-	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
-		return nil, err
+	if err != nil {
+		c.Error(apierror.Internal("Failed to get user information", err))
+		return
 	}
 
-	if len(users) == 0 {
-		return nil, fmt.Errorf("user not found")
+	if !ac.hasRequiredPermissions(user) {
+		ac.sessionService.RevokeSession(c.Request.Context(), session.UserID, session.ID, services.RevokedReasonUser)
+		c.Error(apierror.New(http.StatusForbidden, apierror.CodeInsufficientPermissions, "Access denied: Insufficient permissions"))
+		return
 	}
 
-	return &users[0], nil
+	ac.respondWithTokens(c, user, session.ID, refreshToken, nil)
 }
 
-// getManagementToken gets an access token for the Management API
-func (ac *AuthController) getManagementToken(domain, clientID, clientSecret string) (string, error) {
-	url := fmt.Sprintf("https://%s/oauth/token", domain)
-
-	payload := map[string]interface{}{
-		"grant_type":    "client_credentials",
-		"client_id":     clientID,
-		"client_secret": clientSecret,
-		"audience":      fmt.Sprintf("https://%s/api/v2/", domain),
+// lookupIdentity loads the current roles and sites of a user from the identity provider
+func (ac *AuthController) lookupIdentity(ctx context.Context, userID, email string) (*services.Identity, error) {
+	roles, err := ac.identityProvider.ListRoles(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
-
-	jsonData, err := json.Marshal(payload)
+	sites, err := ac.identityProvider.ListSites(ctx, userID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return &services.Identity{ID: userID, Email: email, Roles: roles, Sites: sites}, nil
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+// respondWithTokens creates the access token and writes the login response
+func (ac *AuthController) respondWithTokens(c *gin.Context, user *services.Identity, sessionID, refreshToken string, recoveryCodes []string) {
+	jwtToken, err := ac.createJWTToken(user, sessionID)
 	if err != nil {
-		return "", err
+		c.Error(apierror.Internal("Failed to create token", err))
+		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	c.JSON(http.StatusOK, LoginResponse{
+		Token:        jwtToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(ac.sessionService.AccessTokenTTL().Seconds()),
+		User: User{
+			ID:          user.ID,
+			Email:       user.Email,
+			Role:        user.PrimaryRole(),
+			Sites:       user.Sites,
+			Permissions: ac.permissionsFor(user),
+		},
+		RecoveryCodes: recoveryCodes,
+	})
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+// Logout handles user logout by redirecting the browser to the provider's logout page
+func (ac *AuthController) Logout(c *gin.Context) {
+	logoutURL, err := ac.logoutURL()
 	if err != nil {
-		return "", err
+		c.Error(apierror.Internal("Failed to build logout URL", err))
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to get management token: %s", string(body))
+	c.Redirect(http.StatusTemporaryRedirect, logoutURL)
+}
+
+// EndSession revokes the session of the current token, so its access and
+// refresh tokens stop working immediately
+func (ac *AuthController) EndSession(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
 	}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if claims.SessionID != "" {
+		err := ac.sessionService.RevokeSession(c.Request.Context(), claims.Sub, claims.SessionID, services.RevokedReasonLogout)
+		if err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+			c.Error(apierror.Internal("Failed to end session", err))
+			return
+		}
 	}
 
-	accessToken, ok := result["access_token"].(string)
-	if !ok {
-		return "", fmt.Errorf("no access token in response")
+	logoutURL, err := ac.logoutURL()
+	if err != nil {
+		c.Error(apierror.Internal("Failed to build logout URL", err))
+		return
 	}
 
-	return accessToken, nil
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Logged out",
+		"logout_url": logoutURL,
+	})
 }
 
-// hasRequiredPermissions checks if user has admin role or site access
-func (ac *AuthController) hasRequiredPermissions(user *Auth0User) bool {
-	role := ac.getUserRole(user)
-	sites := ac.getUserSites(user)
-	siteID := os.Getenv("SITE_ID")
+// logoutURL returns where the browser should go after logout. Providers with
+// their own session (Auth0) must end it as well.
+func (ac *AuthController) logoutURL() (string, error) {
+	siteURL := config.Get().Site.URL
 
-	// Check for admin role
-	if role == "admin" {
-		return true
+	if provider, ok := ac.identityProvider.(services.LogoutURLProvider); ok {
+		return provider.LogoutURL(siteURL)
 	}
 
-	// Check for site access if SITE_ID is configured
-	if siteID != "" {
-		for _, site := range sites {
-			if site == siteID {
-				return true
-			}
-		}
+	return siteURL, nil
+}
+
+// Profile returns the current user's profile
+func (ac *AuthController) Profile(c *gin.Context) {
+	if _, exists := c.Get("user"); !exists {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
 	}
 
-	return false
-}
+	// Convert claims to Auth0Claims type
+	auth0Claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Internal("Invalid user data", nil))
+		return
+	}
 
-// getUserRole extracts role from user's app metadata
-func (ac *AuthController) getUserRole(user *Auth0User) string {
-	if user.AppMetadata == nil {
-		return ""
+	// Extract role and sites from app metadata
+	var role string
+	if roles := auth0Claims.Roles(); len(roles) > 0 {
+		role = roles[0]
 	}
-	if role, ok := user.AppMetadata["role"].(string); ok {
-		return role
+
+	user := User{
+		ID:          auth0Claims.Sub,
+		Email:       auth0Claims.Email,
+		Role:        role,
+		Sites:       auth0Claims.Sites(),
+		Permissions: auth0Claims.EffectivePermissions(),
 	}
-	return ""
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
-// getUserSites extracts sites from user's app metadata
-func (ac *AuthController) getUserSites(user *Auth0User) []string {
-	if user.AppMetadata == nil {
-		return []string{}
-	}
-	if sites, ok := user.AppMetadata["sites"].([]interface{}); ok {
-		var siteStrings []string
-		for _, site := range sites {
-			if siteStr, ok := site.(string); ok {
-				siteStrings = append(siteStrings, siteStr)
-			}
-		}
-		return siteStrings
+// currentClaims returns the token claims stored by the auth middleware
+func currentClaims(c *gin.Context) (*middleware.Auth0Claims, bool) {
+	claims, exists := c.Get("user")
+	if !exists {
+		return nil, false
 	}
-	return []string{}
+	auth0Claims, ok := claims.(*middleware.Auth0Claims)
+	return auth0Claims, ok
 }
 
-// createJWTToken creates our own JWT token with user information
-func (ac *AuthController) createJWTToken(user *Auth0User) (string, error) {
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		secretKey = "your-secret-key" // Fallback for development
+// requestDB returns the database handle bound to the request context, which
+// scopes tenant data to the site of the request, or nil without a connection
+func requestDB(c *gin.Context) *gorm.DB {
+	db := config.GetDB()
+	if db == nil {
+		return nil
 	}
+	return db.WithContext(c.Request.Context())
+}
 
+// hasRequiredPermissions checks if user holds at least one permission of the admin panel
+func (ac *AuthController) hasRequiredPermissions(user *services.Identity) bool {
+	return len(ac.permissionsFor(user)) > 0
+}
+
+// permissionsFor resolves the permissions granted by the user's roles and sites
+func (ac *AuthController) permissionsFor(user *services.Identity) []string {
+	return permissions.Default().Resolve(user.Roles, user.Sites, config.Get().Site.ID)
+}
+
+// createJWTToken creates our own short-lived JWT token with user information
+func (ac *AuthController) createJWTToken(user *services.Identity, sessionID string) (string, error) {
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   user.UserID,
-		"email": user.Email,
-		"https://your-namespace.com/app_metadata": map[string]interface{}{
-			"role":  ac.getUserRole(user),
-			"sites": ac.getUserSites(user),
+		"sub":         user.ID,
+		"email":       user.Email,
+		"sid":         sessionID,
+		"permissions": ac.permissionsFor(user),
+		middleware.DefaultClaimsMapping().Namespace: map[string]interface{}{
+			"role":  user.PrimaryRole(),
+			"roles": user.Roles,
+			"sites": user.Sites,
 		},
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(ac.sessionService.AccessTokenTTL()).Unix(),
 	})
 
-	return token.SignedString([]byte(secretKey))
+	return token.SignedString(middleware.JWTSecret())
 }
-
@@ -1,25 +1,35 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"manage/internal/apierror"
+	"manage/internal/background"
 	"manage/internal/config"
+	"manage/internal/metrics"
+	"manage/internal/middleware"
 	"manage/internal/models"
+	"manage/internal/repository"
 	"manage/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ContactRequestController struct {
-	emailService *services.EmailService
+	contactRequests repository.ContactRequestRepository
+	emailService    *services.EmailService
 }
 
 // NewContactRequestController creates a new contact request controller
-func NewContactRequestController() *ContactRequestController {
+func NewContactRequestController(contactRequests repository.ContactRequestRepository) *ContactRequestController {
 	return &ContactRequestController{
-		emailService: services.NewEmailService(),
+		contactRequests: contactRequests,
+		emailService:    services.NewEmailService(),
 	}
 }
 
@@ -30,19 +40,21 @@ func (crc *ContactRequestController) CreateContactRequest(c *gin.Context) {
 		Email   string `json:"email" binding:"required,email"`
 		Phone   string `json:"phone"`
 		Message string `json:"message" binding:"required"`
+		// Website is a honeypot: the form hides the field, so only bots fill it in
+		Website string `json:"website"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request. Name, email, and message are required.",
-		})
+		c.Error(apierror.Validation(err))
 		return
 	}
 
-	db := config.GetDB()
-	if db == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Database connection not available",
+	// Answer bots as if the request was saved, so they do not try again
+	if req.Website != "" {
+		metrics.ContactSubmission(metrics.ContactSpam)
+		logger.InfoContext(c.Request.Context(), "Contact request rejected as spam", "reason", "honeypot")
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Contact request received successfully",
 		})
 		return
 	}
@@ -67,21 +79,27 @@ func (crc *ContactRequestController) CreateContactRequest(c *gin.Context) {
 	}
 
 	// Save to database
-	if err := db.Create(&contactRequest).Error; err != nil {
-		fmt.Printf("Database error saving contact request: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to save contact request",
-			"details": err.Error(),
-		})
+	if err := crc.contactRequests.Create(c.Request.Context(), &contactRequest); config.IsConnectionError(err) {
+		metrics.ContactSubmission(metrics.ContactFailed)
+		middleware.DatabaseUnavailable(c)
+		return
+	} else if err != nil {
+		metrics.ContactSubmission(metrics.ContactFailed)
+		c.Error(apierror.Internal("Failed to save contact request", err))
 		return
 	}
 
-	// Send notification email (non-blocking, log errors but don't fail the request)
-	go func() {
-		if err := crc.sendNotificationEmail(contactRequest); err != nil {
-			fmt.Printf("Failed to send notification email: %v\n", err)
+	metrics.ContactSubmission(metrics.ContactSaved)
+
+	// Send notification email (non-blocking, log errors but don't fail the request);
+	// a shutdown waits for it
+	sent := metrics.EmailQueued()
+	background.Go(c.Request.Context(), "contact request notification", func(ctx context.Context) {
+		defer sent()
+		if err := crc.sendNotificationEmail(ctx, contactRequest); err != nil {
+			logger.ErrorContext(ctx, "Failed to send notification email", "error", err)
 		}
-	}()
+	})
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Contact request received successfully",
@@ -90,7 +108,7 @@ func (crc *ContactRequestController) CreateContactRequest(c *gin.Context) {
 }
 
 // sendNotificationEmail sends an email notification about the new contact request
-func (crc *ContactRequestController) sendNotificationEmail(contactRequest models.ContactRequest) error {
+func (crc *ContactRequestController) sendNotificationEmail(ctx context.Context, contactRequest models.ContactRequest) error {
 	if !crc.emailService.IsConfigured() {
 		return nil // SMTP not configured, silently skip
 	}
@@ -144,7 +162,7 @@ func (crc *ContactRequestController) sendNotificationEmail(contactRequest models
 		crc.formatMetadata(contactRequest),
 	)
 
-	return crc.emailService.SendNotificationEmail(subject, body)
+	return crc.emailService.SendNotificationEmail(ctx, subject, body)
 }
 
 // formatMetadata formats the metadata for display in the email
@@ -164,24 +182,24 @@ func (crc *ContactRequestController) formatMetadata(contactRequest models.Contac
 
 // GetContactRequests returns all contact requests
 func (crc *ContactRequestController) GetContactRequests(c *gin.Context) {
-	db := config.GetDB()
-	if db == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Database connection not available",
-		})
+	// Newest first
+	requests, err := crc.contactRequests.List(c.Request.Context())
+	if config.IsConnectionError(err) {
+		middleware.DatabaseUnavailable(c)
 		return
 	}
-
-	var requests []models.ContactRequest
-
-	// Order by created_at descending (newest first)
-	if err := db.Order("created_at DESC").Find(&requests).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to fetch contact requests",
-		})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch contact requests", err))
 		return
 	}
 
+	// Record whose personal data was shown
+	ids := make([]uint, 0, len(requests))
+	for _, request := range requests {
+		ids = append(ids, request.ID)
+	}
+	middleware.AuditDetail(c, "contact_request_ids", ids)
+
 	c.JSON(http.StatusOK, gin.H{
 		"requests": requests,
 	})
@@ -189,26 +207,55 @@ func (crc *ContactRequestController) GetContactRequests(c *gin.Context) {
 
 // GetContactRequest returns a single contact request by ID
 func (crc *ContactRequestController) GetContactRequest(c *gin.Context) {
-	db := config.GetDB()
-	if db == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Database connection not available",
-		})
+	request, ok := crc.findContactRequest(c)
+	if !ok {
 		return
 	}
 
-	var request models.ContactRequest
-	id := c.Param("id")
+	c.JSON(http.StatusOK, gin.H{
+		"request": request,
+	})
+}
 
-	if err := db.First(&request, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Contact request not found",
-		})
+// DeleteContactRequest permanently removes a contact request, e.g. on a data deletion request
+func (crc *ContactRequestController) DeleteContactRequest(c *gin.Context) {
+	request, ok := crc.findContactRequest(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"request": request,
-	})
+	// Only non-personal fields are kept, so the audit log does not undo the deletion
+	middleware.AuditBefore(c, gin.H{"id": request.ID, "created_at": request.CreatedAt})
+
+	if err := crc.contactRequests.Delete(c.Request.Context(), request.ID); config.IsConnectionError(err) {
+		middleware.DatabaseUnavailable(c)
+		return
+	} else if err != nil {
+		c.Error(apierror.Internal("Failed to delete contact request", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
 
+// findContactRequest loads the contact request named by the id parameter and
+// answers the request itself when that fails
+func (crc *ContactRequestController) findContactRequest(c *gin.Context) (*models.ContactRequest, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	var request *models.ContactRequest
+	if err == nil {
+		request, err = crc.contactRequests.Get(c.Request.Context(), uint(id))
+	}
+
+	switch {
+	case err == nil:
+		return request, true
+	case config.IsConnectionError(err):
+		middleware.DatabaseUnavailable(c)
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, strconv.ErrSyntax), errors.Is(err, strconv.ErrRange):
+		c.Error(apierror.NotFound("Contact request not found"))
+	default:
+		c.Error(apierror.Internal("Failed to fetch contact request", err))
+	}
+	return nil, false
+}
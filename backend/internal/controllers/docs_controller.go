@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http"
+
+	"manage/internal/apidocs"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DocsController struct{}
+
+// NewDocsController creates a new API documentation controller
+func NewDocsController() *DocsController {
+	return &DocsController{}
+}
+
+// OpenAPI returns the OpenAPI 3 document of the API
+func (dc *DocsController) OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", apidocs.JSON())
+}
+
+// Docs returns a page rendering the OpenAPI document for people
+func (dc *DocsController) Docs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", apidocs.HTML())
+}
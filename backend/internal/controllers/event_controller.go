@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"manage/internal/apierror"
+	"manage/internal/config"
+	"manage/internal/middleware"
+	"manage/internal/models"
+	"manage/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type EventController struct {
+	structuredDataService *services.StructuredDataService
+}
+
+// NewEventController creates a new event controller; structured data names
+// and links the site of each event from siteService
+func NewEventController(siteService *services.SiteService) *EventController {
+	return &EventController{
+		structuredDataService: services.NewStructuredDataService(siteService),
+	}
+}
+
+// EventRequest represents the request body for creating or updating an event
+type EventRequest struct {
+	Title         string     `json:"title" binding:"required"`
+	Description   string     `json:"description"`
+	StartTime     time.Time  `json:"start_time" binding:"required"`
+	EndTime       *time.Time `json:"end_time"`
+	LocationName  string     `json:"location_name" binding:"required"`
+	StreetAddress *string    `json:"street_address"`
+	City          *string    `json:"city"`
+	PostalCode    *string    `json:"postal_code"`
+	Country       *string    `json:"country"`
+	ImageURL      *string    `json:"image_url"`
+	Status        string     `json:"status" binding:"omitempty,oneof=scheduled cancelled postponed rescheduled moved_online"`
+}
+
+// GetEvents returns upcoming events, or all events when ?past=true is given
+func (ec *EventController) GetEvents(c *gin.Context) {
+	db := requestDB(c)
+	if db == nil {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+
+	events, err := ec.findEvents(c)
+	if config.IsConnectionError(err) {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch events", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+	})
+}
+
+// GetEvent returns a single event by ID
+func (ec *EventController) GetEvent(c *gin.Context) {
+	db := requestDB(c)
+	if db == nil {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+
+	event, ok := ec.findEvent(c, db)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"event": event,
+	})
+}
+
+// GetEventsStructuredData returns schema.org JSON-LD and Open Graph metadata for the listed events
+func (ec *EventController) GetEventsStructuredData(c *gin.Context) {
+	db := requestDB(c)
+	if db == nil {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+
+	events, err := ec.findEvents(c)
+	if config.IsConnectionError(err) {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch events", err))
+		return
+	}
+
+	metadata := make([]*services.EventMetadata, 0, len(events))
+	for _, event := range events {
+		m, err := ec.structuredDataService.EventMetadata(c.Request.Context(), event)
+		if config.IsConnectionError(err) {
+			middleware.DatabaseUnavailable(c)
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to build structured data", "event_id", event.ID, "error", err)
+			c.Error(apierror.Internal("Failed to build structured data", err))
+			return
+		}
+		metadata = append(metadata, m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": metadata,
+	})
+}
+
+// GetEventStructuredData returns schema.org JSON-LD and Open Graph metadata for a single event
+func (ec *EventController) GetEventStructuredData(c *gin.Context) {
+	db := requestDB(c)
+	if db == nil {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+
+	event, ok := ec.findEvent(c, db)
+	if !ok {
+		return
+	}
+
+	metadata, err := ec.structuredDataService.EventMetadata(c.Request.Context(), *event)
+	if config.IsConnectionError(err) {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to build structured data", "event_id", event.ID, "error", err)
+		c.Error(apierror.Internal("Failed to build structured data", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+// CreateEvent handles POST requests to create a new event
+func (ec *EventController) CreateEvent(c *gin.Context) {
+	var req EventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.Error(err)
+		return
+	}
+
+	db := requestDB(c)
+	if db == nil {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+
+	var event models.Event
+	ec.applyRequest(&event, req)
+
+	if err := db.Create(&event).Error; err != nil {
+		c.Error(apierror.Internal("Failed to save event", err))
+		return
+	}
+	middleware.AuditTarget(c, event.ID)
+	middleware.AuditAfter(c, event)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"event": event,
+	})
+}
+
+// UpdateEvent handles PUT requests to replace an existing event
+func (ec *EventController) UpdateEvent(c *gin.Context) {
+	var req EventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.Error(err)
+		return
+	}
+
+	db := requestDB(c)
+	if db == nil {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+
+	event, ok := ec.findEvent(c, db)
+	if !ok {
+		return
+	}
+
+	middleware.AuditBefore(c, event)
+	ec.applyRequest(event, req)
+
+	if err := db.Save(event).Error; err != nil {
+		c.Error(apierror.Internal("Failed to update event", err))
+		return
+	}
+	middleware.AuditAfter(c, event)
+
+	c.JSON(http.StatusOK, gin.H{
+		"event": event,
+	})
+}
+
+// DeleteEvent handles DELETE requests to remove an event
+func (ec *EventController) DeleteEvent(c *gin.Context) {
+	db := requestDB(c)
+	if db == nil {
+		middleware.DatabaseUnavailable(c)
+		return
+	}
+
+	event, ok := ec.findEvent(c, db)
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, event)
+
+	if err := db.Delete(event).Error; err != nil {
+		c.Error(apierror.Internal("Failed to delete event", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// findEvent loads the event named by the id parameter and answers the request
+// itself when that fails
+func (ec *EventController) findEvent(c *gin.Context, db *gorm.DB) (*models.Event, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	var event models.Event
+	if err == nil {
+		err = db.First(&event, uint(id)).Error
+	}
+
+	switch {
+	case err == nil:
+		return &event, true
+	case config.IsConnectionError(err):
+		middleware.DatabaseUnavailable(c)
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, strconv.ErrSyntax), errors.Is(err, strconv.ErrRange):
+		c.Error(apierror.NotFound("Event not found"))
+	default:
+		c.Error(apierror.Internal("Failed to fetch event", err))
+	}
+	return nil, false
+}
+
+// findEvents loads events ordered by start time, skipping past events unless ?past=true is given
+func (ec *EventController) findEvents(c *gin.Context) ([]models.Event, error) {
+	db := requestDB(c)
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	query := db.Order("start_time ASC")
+	if c.Query("past") != "true" {
+		// Events without an end time stay listed for a few hours after they start
+		query = query.Where("COALESCE(end_time, start_time + INTERVAL '3 hours') >= ?", time.Now())
+	}
+
+	var events []models.Event
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// validate checks the fields that binding tags cannot express
+func (req EventRequest) validate() error {
+	if req.EndTime != nil && req.EndTime.Before(req.StartTime) {
+		return apierror.Invalid("end_time", "after_start", "must not be before start_time")
+	}
+	return nil
+}
+
+// applyRequest copies the request fields onto the event
+func (ec *EventController) applyRequest(event *models.Event, req EventRequest) {
+	event.Title = req.Title
+	event.Description = req.Description
+	event.StartTime = req.StartTime
+	event.EndTime = req.EndTime
+	event.LocationName = req.LocationName
+	event.StreetAddress = req.StreetAddress
+	event.City = req.City
+	event.PostalCode = req.PostalCode
+	event.Country = req.Country
+	event.ImageURL = req.ImageURL
+	event.Status = req.Status
+	if event.Status == "" {
+		event.Status = models.EventStatusScheduled
+	}
+}
@@ -3,41 +3,79 @@ package controllers
 import (
 	"net/http"
 
-	"manage/internal/config"
+	"manage/internal/health"
 
 	"github.com/gin-gonic/gin"
 )
 
-type HealthController struct{}
+type HealthController struct {
+	// ready reports false while the server is shutting down
+	ready func() bool
+	// checks holds the dependency checks; critical ones decide readiness
+	checks *health.Registry
+}
 
 // NewHealthController creates a new health controller
-func NewHealthController() *HealthController {
-	return &HealthController{}
+func NewHealthController(ready func() bool, checks *health.Registry) *HealthController {
+	return &HealthController{ready: ready, checks: checks}
 }
 
-// HealthCheck returns the health status of the API
+// HealthCheck returns the health status of the API. It answers 503 while a
+// critical dependency such as the database is down.
 func (hc *HealthController) HealthCheck(c *gin.Context) {
+	report := hc.checks.RunCritical(c.Request.Context())
+
 	response := gin.H{
-		"status": "ok",
-		"service": "manage-api",
+		"status":   "ok",
+		"service":  "manage-api",
+		"database": "connected",
+	}
+	status := http.StatusOK
+	if report.Status == health.StatusDown {
+		response["status"] = "unavailable"
+		response["database"] = "disconnected"
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, response)
+}
+
+// Liveness tells the container runtime whether the process still serves
+// requests. It does not check dependencies: restarting the backend does not
+// bring the database back.
+func (hc *HealthController) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// Readiness tells load balancers whether to send requests to this instance.
+// It fails as soon as a shutdown begins, while in-flight requests still drain,
+// and while a critical dependency such as the database is down.
+func (hc *HealthController) Readiness(c *gin.Context) {
+	if !hc.ready() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
 	}
 
-	// Check database connection
-	db := config.GetDB()
-	if db != nil {
-		sqlDB, err := db.DB()
-		if err == nil {
-			if err := sqlDB.Ping(); err == nil {
-				response["database"] = "connected"
-			} else {
-				response["database"] = "disconnected"
-			}
-		} else {
-			response["database"] = "error"
+	report := hc.checks.RunCritical(c.Request.Context())
+	if report.Status == health.StatusDown {
+		// Only names and states; errors are for the authenticated details
+		checks := gin.H{}
+		for _, result := range report.Checks {
+			checks[result.Name] = result.Status
 		}
-	} else {
-		response["database"] = "not_initialized"
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// Details reports every dependency check with its latency and error
+func (hc *HealthController) Details(c *gin.Context) {
+	report := hc.checks.Run(c.Request.Context())
 
-	c.JSON(http.StatusOK, response)
+	status := http.StatusOK
+	if report.Status == health.StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
 }
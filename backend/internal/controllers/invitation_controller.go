@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"manage/internal/apierror"
+	"manage/internal/config"
+	"manage/internal/middleware"
+	"manage/internal/models"
+	"manage/internal/permissions"
+	"manage/internal/repository"
+	"manage/internal/services"
+	"manage/internal/tenancy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InvitationController handles inviting new admins by email and accepting invitations
+type InvitationController struct {
+	identityProvider  services.IdentityProvider
+	invitationService *services.InvitationService
+	roles             permissions.Roles
+}
+
+// NewInvitationController creates a new invitation controller; accepted
+// invitations of the local identity provider create accounts in users.
+// Invitations may grant the given roles.
+func NewInvitationController(users repository.UserRepository, invitationService *services.InvitationService, roles permissions.Roles) *InvitationController {
+	identityProvider, err := services.NewIdentityProvider(users)
+	if err != nil {
+		logger.Error("Identity provider unavailable", "error", err)
+	}
+	return &InvitationController{
+		identityProvider:  identityProvider,
+		invitationService: invitationService,
+		roles:             roles,
+	}
+}
+
+// InvitationRequest represents the request body for inviting a new admin
+type InvitationRequest struct {
+	Email string   `json:"email" binding:"required,email"`
+	Roles []string `json:"roles" binding:"required,min=1"`
+	Sites []string `json:"sites"`
+}
+
+// InvitationTokenRequest represents the token from an invitation link
+type InvitationTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// AcceptInvitationRequest represents the request body for accepting an invitation
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// InvitationResponse is an invitation together with its current status
+type InvitationResponse struct {
+	models.Invitation
+	Status string `json:"status"`
+}
+
+// GetInvitations returns all invitations, optionally filtered by ?status=
+func (ic *InvitationController) GetInvitations(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.InvitationStatusPending, models.InvitationStatusAccepted, models.InvitationStatusRevoked, models.InvitationStatusExpired:
+	default:
+		c.Error(apierror.Invalid("status", "oneof", "must be one of pending, accepted, revoked, expired"))
+		return
+	}
+
+	invitations, err := ic.invitationService.List(c.Request.Context(), status)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch invitations", err))
+		return
+	}
+
+	response := make([]InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		response = append(response, newInvitationResponse(&invitation))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invitations": response,
+	})
+}
+
+// CreateInvitation invites a person by email with the given roles and sites
+func (ic *InvitationController) CreateInvitation(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	var req InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	// Admins can only grant roles whose permissions they hold themselves
+	granted := claims.EffectivePermissions()
+	for _, role := range req.Roles {
+		perms, ok := ic.roles[role]
+		if !ok {
+			c.Error(apierror.Invalid("roles", "role", fmt.Sprintf("contains the unknown role %q", role)))
+			return
+		}
+		if !permissions.HasAll(granted, perms...) {
+			c.Error(apierror.New(http.StatusForbidden, apierror.CodeInsufficientPermissions, fmt.Sprintf("You do not hold all permissions of the role %q yourself", role)))
+			return
+		}
+	}
+	if len(req.Sites) == 0 {
+		if siteID := middleware.CurrentSite(c); siteID != tenancy.AllSites {
+			req.Sites = []string{siteID}
+		}
+	}
+	// Admins can only invite people to the sites they belong to themselves
+	for _, siteID := range req.Sites {
+		if !middleware.CanAccessSite(claims, siteID) {
+			c.Error(apierror.New(http.StatusForbidden, apierror.CodeSiteAccessDenied, fmt.Sprintf("No access to site %q", siteID)))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if ic.identityProvider != nil {
+		_, err := ic.identityProvider.LookupUser(ctx, req.Email)
+		if err == nil {
+			c.Error(apierror.New(http.StatusConflict, apierror.CodeAlreadyExists, "A user with this email already exists"))
+			return
+		}
+		if !errors.Is(err, services.ErrUserNotFound) {
+			c.Error(apierror.Internal("Failed to create invitation", err))
+			return
+		}
+	}
+
+	invitation, err := ic.invitationService.Create(ctx, strings.TrimSpace(req.Email), req.Roles, req.Sites, ic.actor(c), c.ClientIP())
+	if errors.Is(err, services.ErrInvitationExists) {
+		c.Error(apierror.New(http.StatusConflict, apierror.CodeAlreadyExists, "A pending invitation for this email already exists"))
+		return
+	}
+	if errors.Is(err, services.ErrInvitationEmailFailed) {
+		logger.WarnContext(c.Request.Context(), "Invitation saved, but email failed", "invitation_id", invitation.ID, "error", err)
+		c.JSON(http.StatusCreated, gin.H{
+			"invitation": newInvitationResponse(invitation),
+			"warning":    "The invitation was created, but the email could not be sent. Please resend it.",
+		})
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to create invitation", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": newInvitationResponse(invitation),
+	})
+}
+
+// ResendInvitation sends a pending or expired invitation again with a new link
+func (ic *InvitationController) ResendInvitation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid invitation ID"))
+		return
+	}
+
+	invitation, err := ic.invitationService.Resend(c.Request.Context(), uint(id), ic.actor(c), c.ClientIP())
+	if errors.Is(err, services.ErrInvitationNotFound) {
+		c.Error(apierror.NotFound("Invitation not found"))
+		return
+	}
+	if errors.Is(err, services.ErrInvitationNotPending) {
+		c.Error(apierror.Conflict("Invitation has already been accepted or revoked"))
+		return
+	}
+	if errors.Is(err, services.ErrInvitationEmailFailed) {
+		c.Error(apierror.New(http.StatusBadGateway, apierror.CodeBadGateway, "The invitation email could not be sent").Wrap(err))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to resend invitation", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invitation": newInvitationResponse(invitation),
+	})
+}
+
+// RevokeInvitation withdraws a pending invitation
+func (ic *InvitationController) RevokeInvitation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid invitation ID"))
+		return
+	}
+
+	err = ic.invitationService.Revoke(c.Request.Context(), uint(id), ic.actor(c), c.ClientIP())
+	if errors.Is(err, services.ErrInvitationNotFound) {
+		c.Error(apierror.NotFound("Invitation not found"))
+		return
+	}
+	if errors.Is(err, services.ErrInvitationNotPending) {
+		c.Error(apierror.Conflict("Invitation has already been accepted or revoked"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to revoke invitation", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PreviewInvitation returns the address and roles of a pending invitation, so
+// the accept page can show what the invitee is signing up for
+func (ic *InvitationController) PreviewInvitation(c *gin.Context) {
+	var req InvitationTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	invitation, err := ic.invitationService.Lookup(c.Request.Context(), req.Token)
+	if errors.Is(err, services.ErrInvitationNotFound) || errors.Is(err, services.ErrInvitationNotPending) {
+		c.Error(apierror.NotFound("Invitation is invalid or has expired"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch invitation", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":      invitation.Email,
+		"roles":      invitation.Roles,
+		"sites":      invitation.Sites,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// AcceptInvitation creates the invited account with the chosen password
+func (ic *InvitationController) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	creator, ok := ic.identityProvider.(services.UserCreator)
+	if !ok {
+		c.Error(apierror.Internal("Identity provider cannot create accounts", nil))
+		return
+	}
+
+	user, err := ic.invitationService.Accept(c.Request.Context(), req.Token, req.Password, creator, c.ClientIP())
+	switch {
+	case errors.Is(err, services.ErrInvitationNotFound), errors.Is(err, services.ErrInvitationNotPending):
+		c.Error(apierror.NotFound("Invitation is invalid or has expired"))
+		return
+	case errors.Is(err, services.ErrWeakPassword):
+		c.Error(apierror.Invalid("password", "password_policy", "does not meet the password requirements").Wrap(err))
+		return
+	case errors.Is(err, services.ErrUserExists):
+		c.Error(apierror.New(http.StatusConflict, apierror.CodeAlreadyExists, "An account with this email already exists"))
+		return
+	case err != nil:
+		c.Error(apierror.Internal("Failed to create account", err))
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Invitation accepted", "user_id", user.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Account created. You can now log in.",
+		"user": User{
+			ID:          user.ID,
+			Email:       user.Email,
+			Role:        user.PrimaryRole(),
+			Sites:       user.Sites,
+			Permissions: permissions.Default().Resolve(user.Roles, user.Sites, config.Get().Site.ID),
+		},
+	})
+}
+
+// actor returns the ID of the admin making the request
+func (ic *InvitationController) actor(c *gin.Context) string {
+	if claims, ok := currentClaims(c); ok {
+		return claims.Sub
+	}
+	return ""
+}
+
+// newInvitationResponse adds the current status to an invitation
+func newInvitationResponse(invitation *models.Invitation) InvitationResponse {
+	return InvitationResponse{Invitation: *invitation, Status: invitation.Status()}
+}
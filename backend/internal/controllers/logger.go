@@ -0,0 +1,5 @@
+package controllers
+
+import "manage/internal/logging"
+
+var logger = logging.For("controllers")
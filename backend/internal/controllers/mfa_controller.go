@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"manage/internal/apierror"
+	"manage/internal/config"
+	"manage/internal/middleware"
+	"manage/internal/permissions"
+	"manage/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mfaTokenPurpose marks tokens that only allow completing a login with 2FA
+const mfaTokenPurpose = "mfa_pending"
+
+// mfaTokenTTL is how long a user has to enter the second factor after the password
+const mfaTokenTTL = 5 * time.Minute
+
+// MFAController handles enrollment in two-factor authentication and the
+// roles for which it is enforced
+type MFAController struct {
+	mfaService *services.MFAService
+}
+
+// NewMFAController creates a new MFA controller
+func NewMFAController(mfaService *services.MFAService) *MFAController {
+	return &MFAController{
+		mfaService: mfaService,
+	}
+}
+
+// MFACodeRequest represents a request confirmed with a current TOTP code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFASetupRequest represents the start of an enrollment that is enforced at login
+type MFASetupRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// MFAPolicyRequest represents the roles for which 2FA is enforced
+type MFAPolicyRequest struct {
+	EnforcedRoles []string `json:"enforced_roles"`
+}
+
+// GetStatus returns whether the current user has 2FA enabled and must use it
+func (mc *MFAController) GetStatus(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	enrolled, err := mc.mfaService.IsEnrolled(ctx, claims.Sub)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch two-factor status", err))
+		return
+	}
+	required, err := mc.mfaService.IsRequired(ctx, claims.Roles())
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch two-factor status", err))
+		return
+	}
+
+	var remaining int64
+	if enrolled {
+		if remaining, err = mc.mfaService.RecoveryCodesRemaining(ctx, claims.Sub); err != nil {
+			c.Error(apierror.Internal("Failed to fetch two-factor status", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enrolled":                 enrolled,
+		"required":                 required,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// BeginEnrollment creates a new TOTP secret for the current user. The
+// otpauth URI is meant to be shown as a QR code.
+func (mc *MFAController) BeginEnrollment(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	mc.beginEnrollment(c, claims.Sub, claims.Email)
+}
+
+// BeginPendingEnrollment creates a new TOTP secret for a user who must enroll
+// before their login can complete, authenticated by the token from login
+func (mc *MFAController) BeginPendingEnrollment(c *gin.Context) {
+	var req MFASetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	pending, err := parseMFAToken(req.MFAToken)
+	if err != nil {
+		c.Error(apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired two-factor token"))
+		return
+	}
+
+	mc.beginEnrollment(c, pending.Sub, pending.Email)
+}
+
+// ConfirmEnrollment enables 2FA for the current user once a code from the new
+// authenticator is entered, and returns the recovery codes
+func (mc *MFAController) ConfirmEnrollment(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	codes, err := mc.mfaService.ConfirmEnrollment(c.Request.Context(), claims.Sub, req.Code, c.ClientIP())
+	if mc.handleError(c, err, "Failed to enable two-factor authentication") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	codes, err := mc.mfaService.RegenerateRecoveryCodes(c.Request.Context(), claims.Sub, req.Code)
+	if mc.handleError(c, err, "Failed to regenerate recovery codes") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// Disable turns off 2FA for the current user, unless it is enforced for their roles
+func (mc *MFAController) Disable(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	err := mc.mfaService.Disable(c.Request.Context(), claims.Sub, claims.Roles(), req.Code, c.ClientIP())
+	if mc.handleError(c, err, "Failed to disable two-factor authentication") {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetPolicy returns the roles for which 2FA is enforced
+func (mc *MFAController) GetPolicy(c *gin.Context) {
+	roles, err := mc.mfaService.EnforcedRoles(c.Request.Context())
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch two-factor policy", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enforced_roles": roles,
+	})
+}
+
+// UpdatePolicy replaces the roles for which 2FA is enforced. Members of these
+// roles have to enroll at their next login.
+func (mc *MFAController) UpdatePolicy(c *gin.Context) {
+	var req MFAPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	knownRoles := permissions.Default()
+	for _, role := range req.EnforcedRoles {
+		if _, ok := knownRoles[role]; !ok {
+			c.Error(apierror.Invalid("enforced_roles", "role", fmt.Sprintf("contains the unknown role %q", role)))
+			return
+		}
+	}
+
+	actor := ""
+	if claims, ok := currentClaims(c); ok {
+		actor = claims.Sub
+	}
+
+	if before, err := mc.mfaService.EnforcedRoles(c.Request.Context()); err == nil {
+		middleware.AuditBefore(c, gin.H{"enforced_roles": before})
+	}
+
+	if err := mc.mfaService.SetEnforcedRoles(c.Request.Context(), req.EnforcedRoles, actor, c.ClientIP()); err != nil {
+		c.Error(apierror.Internal("Failed to update two-factor policy", err))
+		return
+	}
+	middleware.AuditAfter(c, gin.H{"enforced_roles": req.EnforcedRoles})
+
+	mc.GetPolicy(c)
+}
+
+// beginEnrollment starts an enrollment and responds with the secret and its URI
+func (mc *MFAController) beginEnrollment(c *gin.Context, userID, email string) {
+	secret, uri, err := mc.mfaService.BeginEnrollment(c.Request.Context(), userID, email)
+	if mc.handleError(c, err, "Failed to start two-factor enrollment") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+	})
+}
+
+// handleError writes the response for MFA service errors and reports whether there was one
+func (mc *MFAController) handleError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrInvalidMFACode):
+		c.Error(apierror.New(http.StatusUnauthorized, apierror.CodeInvalidMFACode, "Invalid two-factor code"))
+	case errors.Is(err, services.ErrMFANotEnrolled):
+		c.Error(apierror.Conflict("Two-factor authentication is not enabled"))
+	case errors.Is(err, services.ErrMFAAlreadyEnrolled):
+		c.Error(apierror.Conflict("Two-factor authentication is already enabled"))
+	case errors.Is(err, services.ErrMFAEnrollmentNotStarted):
+		c.Error(apierror.Conflict("Two-factor enrollment has not been started"))
+	case errors.Is(err, services.ErrMFARequired):
+		c.Error(apierror.New(http.StatusForbidden, apierror.CodeMFARequired, "Two-factor authentication is required for your role"))
+	case config.IsConnectionError(err):
+		middleware.DatabaseUnavailable(c)
+	default:
+		c.Error(apierror.Internal(message, err))
+	}
+	return true
+}
+
+// createMFAToken creates the short-lived token that proves the password step
+// of a login succeeded. The purpose claim keeps it from being used as an access token.
+func createMFAToken(user *services.Identity) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":     user.ID,
+		"email":   user.Email,
+		"purpose": mfaTokenPurpose,
+		"iat":     now.Unix(),
+		"exp":     now.Add(mfaTokenTTL).Unix(),
+	})
+
+	return token.SignedString(middleware.JWTSecret())
+}
+
+// parseMFAToken validates a token created by createMFAToken
+func parseMFAToken(tokenString string) (*middleware.Auth0Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &middleware.Auth0Claims{}, func(*jwt.Token) (interface{}, error) {
+		return middleware.JWTSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*middleware.Auth0Claims)
+	if !ok || !token.Valid || claims.Purpose != mfaTokenPurpose || claims.Sub == "" {
+		return nil, fmt.Errorf("invalid two-factor token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"manage/internal/apierror"
+	"manage/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SecurityController exposes login lockouts and the security audit trail to admins
+type SecurityController struct {
+	loginThrottle  *services.LoginThrottleService
+	securityEvents *services.SecurityEventService
+}
+
+// NewSecurityController creates a new security controller
+func NewSecurityController(loginThrottle *services.LoginThrottleService, securityEvents *services.SecurityEventService) *SecurityController {
+	return &SecurityController{
+		loginThrottle:  loginThrottle,
+		securityEvents: securityEvents,
+	}
+}
+
+// GetLockouts returns the accounts and IPs that are currently locked out
+func (sc *SecurityController) GetLockouts(c *gin.Context) {
+	lockouts, err := sc.loginThrottle.ListLockouts(c.Request.Context())
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch lockouts", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": lockouts,
+	})
+}
+
+// ClearLockout lifts a lockout before it expires
+func (sc *SecurityController) ClearLockout(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid lockout ID"))
+		return
+	}
+
+	actor := ""
+	if claims, ok := currentClaims(c); ok {
+		actor = claims.Sub
+	}
+
+	err = sc.loginThrottle.ClearLockout(c.Request.Context(), uint(id), actor, c.ClientIP())
+	if errors.Is(err, services.ErrLockoutNotFound) {
+		c.Error(apierror.NotFound("Lockout not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to clear lockout", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetSecurityEvents returns the newest security events, optionally filtered by ?type=
+func (sc *SecurityController) GetSecurityEvents(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.Error(apierror.BadRequest("limit must be between 1 and 1000"))
+		return
+	}
+
+	events, err := sc.securityEvents.List(c.Request.Context(), c.Query("type"), limit)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch security events", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+	})
+}
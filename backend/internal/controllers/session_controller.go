@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"manage/internal/apierror"
+	"manage/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionController lets users list and revoke their active login sessions
+type SessionController struct {
+	sessionService *services.SessionService
+}
+
+// NewSessionController creates a new session controller
+func NewSessionController(sessionService *services.SessionService) *SessionController {
+	return &SessionController{
+		sessionService: sessionService,
+	}
+}
+
+// GetSessions returns the active sessions of the current user
+func (sc *SessionController) GetSessions(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	sessions, err := sc.sessionService.ListSessions(c.Request.Context(), claims.Sub)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch sessions", err))
+		return
+	}
+
+	response := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, gin.H{
+			"id":           session.ID,
+			"ip_address":   session.IPAddress,
+			"user_agent":   session.UserAgent,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == claims.SessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": response,
+	})
+}
+
+// RevokeSession revokes one session of the current user
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	err := sc.sessionService.RevokeSession(c.Request.Context(), claims.Sub, c.Param("id"), services.RevokedReasonUser)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		c.Error(apierror.NotFound("Session not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to revoke session", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeAllSessions signs the current user out everywhere, including this session
+func (sc *SessionController) RevokeAllSessions(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	if err := sc.sessionService.RevokeAllSessions(c.Request.Context(), claims.Sub, services.RevokedReasonSignOutAll); err != nil {
+		c.Error(apierror.Internal("Failed to revoke sessions", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
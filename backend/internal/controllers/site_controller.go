@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"manage/internal/apierror"
+	"manage/internal/config"
+	"manage/internal/middleware"
+	"manage/internal/models"
+	"manage/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SiteController manages the sites (congregations) sharing this deployment
+type SiteController struct {
+	siteService *services.SiteService
+}
+
+// NewSiteController creates a new site controller
+func NewSiteController(siteService *services.SiteService) *SiteController {
+	return &SiteController{
+		siteService: siteService,
+	}
+}
+
+// SiteRequest represents the request body for creating or updating a site
+type SiteRequest struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name" binding:"required"`
+	Hosts []string `json:"hosts"`
+	// URL is the public website; empty derives it from SITE_URL or the hosts
+	URL string `json:"url" binding:"omitempty,url"`
+}
+
+// GetSites returns the sites the current user can access, e.g. for a site switcher
+func (sc *SiteController) GetSites(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apierror.Unauthorized("User not authenticated"))
+		return
+	}
+
+	sites, err := sc.siteService.List(c.Request.Context())
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch sites", err))
+		return
+	}
+
+	accessible := make([]models.Site, 0, len(sites))
+	for _, site := range sites {
+		if middleware.CanAccessSite(claims, site.ID) {
+			accessible = append(accessible, site)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sites":   accessible,
+		"current": middleware.CurrentSite(c),
+	})
+}
+
+// CreateSite adds a site
+func (sc *SiteController) CreateSite(c *gin.Context) {
+	var req SiteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+	if req.ID == "" {
+		c.Error(apierror.Invalid("id", "required", "is required"))
+		return
+	}
+
+	site, err := sc.siteService.Create(c.Request.Context(), req.ID, req.Name, req.URL, req.Hosts)
+	if sc.handleError(c, err, "Failed to create site") {
+		return
+	}
+	middleware.AuditTarget(c, site.ID)
+	middleware.AuditAfter(c, site)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"site": site,
+	})
+}
+
+// UpdateSite changes the name, website and host names of a site
+func (sc *SiteController) UpdateSite(c *gin.Context) {
+	var req SiteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apierror.Validation(err))
+		return
+	}
+
+	site, err := sc.siteService.Update(c.Request.Context(), c.Param("id"), req.Name, req.URL, req.Hosts)
+	if sc.handleError(c, err, "Failed to update site") {
+		return
+	}
+	middleware.AuditAfter(c, site)
+
+	c.JSON(http.StatusOK, gin.H{
+		"site": site,
+	})
+}
+
+// handleError writes the response for a site service error and reports whether there was one
+func (sc *SiteController) handleError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrSiteNotFound):
+		c.Error(apierror.NotFound("Site not found"))
+	case errors.Is(err, services.ErrSiteExists):
+		c.Error(apierror.New(http.StatusConflict, apierror.CodeAlreadyExists, "A site with this ID already exists"))
+	case errors.Is(err, services.ErrHostTaken):
+		c.Error(apierror.Conflict("A host is already assigned to another site"))
+	case errors.Is(err, services.ErrInvalidSiteID):
+		c.Error(apierror.Invalid("id", "format", "must consist of lowercase letters, digits and dashes"))
+	case config.IsConnectionError(err):
+		middleware.DatabaseUnavailable(c)
+	default:
+		c.Error(apierror.Internal(message, err))
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"time"
+
+	"manage/internal/migrate"
+	"manage/migrations"
+
+	"gorm.io/gorm"
+)
+
+// Database pings the database and reports the latency
+func Database(pool func() *sql.DB, available func() bool) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		db := pool()
+		if db == nil || !available() {
+			return "", fmt.Errorf("database unavailable")
+		}
+		start := time.Now()
+		if err := db.PingContext(ctx); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ping %s", time.Since(start).Round(time.Microsecond)), nil
+	}
+}
+
+// Migrations reports the schema version. Pending migrations degrade the
+// check, a migration that failed halfway fails it.
+func Migrations(db func() *gorm.DB) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		conn := db()
+		if conn == nil {
+			return "", fmt.Errorf("database unavailable")
+		}
+		migrator, err := migrate.New(conn, migrations.FS)
+		if err != nil {
+			return "", err
+		}
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		detail := fmt.Sprintf("version %d of %d", status.Current, status.Latest)
+		switch {
+		case status.Dirty:
+			return detail, fmt.Errorf("%w at version %d", migrate.ErrDirtySchema, status.Current)
+		case len(status.Pending) > 0:
+			return detail, fmt.Errorf("%w: %d migration(s) pending", ErrDegraded, len(status.Pending))
+		}
+		return detail, nil
+	}
+}
+
+// SMTP connects to the mail server and waits for its greeting
+func SMTP(host string, port int) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		addr := net.JoinHostPort(host, fmt.Sprint(port))
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		client, err := smtp.NewClient(conn, host)
+		if err != nil {
+			return "", fmt.Errorf("no SMTP greeting from %s: %w", addr, err)
+		}
+		client.Quit()
+		return addr, nil
+	}
+}
+
+// HTTP requests url and expects a 2xx response, e.g. from Auth0's OpenID
+// configuration
+func HTTP(client *http.Client, url string) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return "", fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return resp.Status, nil
+	}
+}
+
+// Queue reports the length of a queue, e.g. of emails waiting to be sent in
+// the background, and degrades once it exceeds limit
+func Queue(length func() int64, limit int64) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		n := length()
+		detail := fmt.Sprintf("%d queued", n)
+		if n > limit {
+			return detail, fmt.Errorf("%w: more than %d queued", ErrDegraded, limit)
+		}
+		return detail, nil
+	}
+}
@@ -0,0 +1,217 @@
+// Package health runs checks of the dependencies of the backend, such as the
+// database or the SMTP server. Checks are registered on a Registry, each run
+// is bounded by a timeout, and results are cached so frequent probes do not
+// put load on the dependencies.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"manage/internal/logging"
+)
+
+// Status of a check or of the whole service
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// ErrDegraded marks a dependency that works but needs attention, e.g. a
+// growing email queue
+var ErrDegraded = errors.New("degraded")
+
+var logger = logging.For("health")
+
+// CheckFunc checks a dependency and returns a short detail such as its
+// version or latency. An error wrapping ErrDegraded degrades the check, any
+// other error fails it.
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+// Check is a named check of one dependency
+type Check struct {
+	Name  string
+	Check CheckFunc
+	// Critical checks make the instance unready when they fail
+	Critical bool
+	// Timeout and CacheTTL override the defaults of the registry
+	Timeout  time.Duration
+	CacheTTL time.Duration
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name       string    `json:"name"`
+	Status     Status    `json:"status"`
+	Critical   bool      `json:"critical"`
+	Detail     string    `json:"detail,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS float64   `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Report is the outcome of several checks. Its status is down when a
+// critical check is down and degraded when any other check is not up.
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Registry holds the checks of the service
+type Registry struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu      sync.Mutex
+	entries []*entry
+}
+
+// entry caches the result of a check; mu makes concurrent callers share one run
+type entry struct {
+	check Check
+
+	mu      sync.Mutex
+	result  Result
+	expires time.Time
+}
+
+// NewRegistry creates an empty registry whose checks time out after timeout
+// and whose results are reused for cacheTTL unless a check says otherwise
+func NewRegistry(timeout, cacheTTL time.Duration) *Registry {
+	return &Registry{timeout: timeout, cacheTTL: cacheTTL}
+}
+
+// Register adds a check; its name must be unique
+func (r *Registry) Register(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.entries {
+		if existing.check.Name == check.Name {
+			panic(fmt.Sprintf("health check %q registered twice", check.Name))
+		}
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = r.timeout
+	}
+	if check.CacheTTL <= 0 {
+		check.CacheTTL = r.cacheTTL
+	}
+	r.entries = append(r.entries, &entry{check: check})
+}
+
+// Run runs all checks concurrently, reusing cached results
+func (r *Registry) Run(ctx context.Context) Report {
+	return r.run(ctx, false)
+}
+
+// RunCritical runs only the critical checks, e.g. for readiness probes
+func (r *Registry) RunCritical(ctx context.Context) Report {
+	return r.run(ctx, true)
+}
+
+func (r *Registry) run(ctx context.Context, criticalOnly bool) Report {
+	r.mu.Lock()
+	var entries []*entry
+	for _, e := range r.entries {
+		if e.check.Critical || !criticalOnly {
+			entries = append(entries, e)
+		}
+	}
+	r.mu.Unlock()
+
+	results := make([]Result, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = e.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: results}
+	for _, result := range results {
+		switch {
+		case result.Status == StatusDown && result.Critical:
+			report.Status = StatusDown
+		case result.Status != StatusUp && report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run returns the cached result or runs the check
+func (e *entry) run(ctx context.Context) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if time.Now().Before(e.expires) {
+		return e.result
+	}
+
+	result := e.execute(ctx)
+	previous := e.result.Status
+	if previous == "" {
+		previous = StatusUp
+	}
+	switch {
+	case result.Status == previous:
+	case result.Status == StatusUp:
+		logger.InfoContext(ctx, "Health check recovered", "check", result.Name)
+	default:
+		logger.WarnContext(ctx, "Health check failed", "check", result.Name, "status", result.Status, "error", result.Error)
+	}
+	e.result = result
+	e.expires = result.CheckedAt.Add(e.check.CacheTTL)
+	return result
+}
+
+// execute runs the check with its timeout. The result is shared with other
+// callers, so it does not end when the caller's request does; a check that
+// ignores its context is abandoned after the timeout.
+func (e *entry) execute(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.check.Timeout)
+	defer cancel()
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		detail, err := e.check.Check(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-ctx.Done():
+		o.err = fmt.Errorf("timed out after %s", e.check.Timeout)
+	}
+
+	result := Result{
+		Name:       e.check.Name,
+		Status:     StatusUp,
+		Critical:   e.check.Critical,
+		Detail:     o.detail,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt:  time.Now(),
+	}
+	if o.err != nil {
+		result.Status = StatusDown
+		if errors.Is(o.err, ErrDegraded) {
+			result.Status = StatusDegraded
+		}
+		result.Error = logging.RedactString(o.err.Error())
+	}
+	return result
+}
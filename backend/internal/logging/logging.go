@@ -0,0 +1,187 @@
+// Package logging writes structured logs with log/slog. Every package logs
+// through its own logger from For, whose level can be set per package, log
+// lines of a request carry its ID, and emails, tokens and passwords are
+// redacted before anything is written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats selected by LOG_FORMAT
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Options configures the logs
+type Options struct {
+	// Format is FormatJSON or FormatText
+	Format string
+	// Level is the minimum level, e.g. "info"
+	Level string
+	// Levels overrides the level of single packages, e.g. "gorm=debug"
+	Levels []string
+	// Output defaults to stderr
+	Output io.Writer
+}
+
+// state is the handler and levels all loggers write with
+type state struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+var current atomic.Pointer[state]
+
+func init() {
+	current.Store(&state{handler: newHandler(os.Stderr, FormatJSON), level: slog.LevelInfo})
+	slog.SetDefault(For("default"))
+}
+
+// Setup applies the options to all loggers, including those created before.
+// The standard library's log package writes through the "default" logger.
+func Setup(opts Options) error {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+	levels, err := ParseLevels(opts.Levels)
+	if err != nil {
+		return err
+	}
+	if opts.Format != FormatJSON && opts.Format != FormatText {
+		return fmt.Errorf("log format must be %s or %s, not %q", FormatJSON, FormatText, opts.Format)
+	}
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	current.Store(&state{handler: newHandler(output, opts.Format), level: level, levels: levels})
+	slog.SetDefault(For("default"))
+	return nil
+}
+
+// ParseLevel parses a level name such as "debug", "info", "warn" or "error"
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// ParseLevels parses per-package levels given as "package=level"
+func ParseLevels(entries []string) (map[string]slog.Level, error) {
+	levels := map[string]slog.Level{}
+	for _, entry := range entries {
+		pkg, name, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(pkg) == "" {
+			return nil, fmt.Errorf("invalid log level %q, expected package=level such as gorm=debug", entry)
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(pkg)] = level
+	}
+	return levels, nil
+}
+
+// newHandler creates the redacting handler writing to output
+func newHandler(output io.Writer, format string) slog.Handler {
+	// Levels are checked per package before records reach the handler
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug - 4}
+	if format == FormatText {
+		return &redactingHandler{next: slog.NewTextHandler(output, opts)}
+	}
+	return &redactingHandler{next: slog.NewJSONHandler(output, opts)}
+}
+
+// For returns the logger of a package. It can be created in a package-level
+// variable: the level and handler are looked up on every call, so Setup
+// applies to it later.
+func For(pkg string) *slog.Logger {
+	return slog.New(&packageHandler{pkg: pkg})
+}
+
+// packageHandler writes through the current handler with the level of its
+// package and adds the package, request ID and trace ID to every record
+type packageHandler struct {
+	pkg string
+	// with replays WithAttrs and WithGroup calls on the current handler
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h *packageHandler) Enabled(_ context.Context, level slog.Level) bool {
+	s := current.Load()
+	minimum, ok := s.levels[h.pkg]
+	if !ok {
+		minimum = s.level
+	}
+	return level >= minimum
+}
+
+func (h *packageHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := current.Load().handler.WithAttrs([]slog.Attr{slog.String("package", h.pkg)})
+	if id := RequestID(ctx); id != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("request_id", id)})
+	}
+	if id := traceID(ctx); id != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("trace_id", id)})
+	}
+	for _, with := range h.with {
+		handler = with(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *packageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.extend(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *packageHandler) WithGroup(name string) slog.Handler {
+	return h.extend(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *packageHandler) extend(with func(slog.Handler) slog.Handler) slog.Handler {
+	return &packageHandler{pkg: h.pkg, with: append(append([]func(slog.Handler) slog.Handler(nil), h.with...), with)}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log lines carry the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in the context, if any
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// traceID returns the ID of the OpenTelemetry trace in ctx, if any
+func traceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	span := trace.SpanContextFromContext(ctx)
+	if !span.IsValid() {
+		return ""
+	}
+	return span.TraceID().String()
+}
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[redacted]"
+
+// sensitiveKeys end attribute, JSON and header names whose values are never
+// logged, e.g. refresh_token or X-API-Key, but not access_token_ttl
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "api_key", "apikey", "recovery_code"}
+
+// Patterns of sensitive values in messages, errors and other strings
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	apiKeyPattern = regexp.MustCompile(`ccl_[A-Za-z0-9_\-]+`)
+	schemePattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=\-]+`)
+	// Settings in DSNs and query strings such as password=... or ?token=...
+	settingPattern = regexp.MustCompile(`(?i)\b(password|passwd|secret|token|code|api_key)=[^&\s]+`)
+)
+
+// redactingHandler removes sensitive data from records before passing them on
+type redactingHandler struct {
+	next slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	clean := slog.NewRecord(record.Time, record.Level, RedactString(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		clean.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, clean)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		clean[i] = redactAttr(attr)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(clean)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+// RedactString replaces emails, tokens, API keys and credentials in s
+func RedactString(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = apiKeyPattern.ReplaceAllString(s, redacted)
+	s = schemePattern.ReplaceAllString(s, "$1 "+redacted)
+	s = settingPattern.ReplaceAllString(s, "$1="+redacted)
+	return emailPattern.ReplaceAllString(s, "[email]")
+}
+
+// isSensitiveKey reports whether values under the key are secret
+func isSensitiveKey(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, sensitive := range sensitiveKeys {
+		if strings.HasSuffix(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	if isSensitiveKey(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, RedactString(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		clean := make([]slog.Attr, len(group))
+		for i, member := range group {
+			clean[i] = redactAttr(member)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(clean...)}
+	case slog.KindAny:
+		return slog.Attr{Key: attr.Key, Value: redactAny(value.Any())}
+	default:
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+}
+
+// redactAny turns errors and Stringers into redacted strings, and other values
+// such as structs and maps into redacted JSON-like values
+func redactAny(value interface{}) slog.Value {
+	switch v := value.(type) {
+	case nil:
+		return slog.AnyValue(nil)
+	case error:
+		return slog.StringValue(RedactString(v.Error()))
+	case fmt.Stringer:
+		return slog.StringValue(RedactString(v.String()))
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return slog.StringValue(RedactString(fmt.Sprintf("%+v", value)))
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return slog.StringValue(RedactString(string(data)))
+	}
+	return slog.AnyValue(redactJSON(decoded))
+}
+
+// redactJSON redacts a decoded JSON value
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, member := range v {
+			if isSensitiveKey(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactJSON(member)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, member := range v {
+			v[i] = redactJSON(member)
+		}
+		return v
+	case string:
+		return RedactString(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,151 @@
+// Package metrics collects the Prometheus metrics of the backend: HTTP
+// requests by route, contact submissions, emails, logins and the database
+// pool. They are registered on Registry and served by Handler.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes of contact form submissions
+const (
+	ContactSaved  = "saved"
+	ContactSpam   = "spam"
+	ContactFailed = "failed"
+)
+
+// Results of login attempts
+const (
+	LoginSuccess            = "success"
+	LoginMFARequired        = "mfa_required"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginThrottled          = "throttled"
+	LoginForbidden          = "forbidden"
+	LoginError              = "error"
+)
+
+// Registry holds the metrics of the backend and of the Go runtime
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by method and route.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route"})
+
+	contactSubmissions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "contact_submissions_total",
+		Help: "Contact form submissions by outcome: saved, spam or failed.",
+	}, []string{"outcome"})
+
+	emailsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_sends_total",
+		Help: "Emails handed to the SMTP server by result: success or failure.",
+	}, []string{"result"})
+
+	// emailQueueDepth counts the emails waiting to be sent in the background
+	emailQueueDepth atomic.Int64
+	emailQueue      = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "email_queue_depth",
+		Help: "Emails waiting to be sent or being sent in the background.",
+	}, func() float64 {
+		return float64(emailQueueDepth.Load())
+	})
+
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "login_attempts_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, contactSubmissions, emailsSent, emailQueue, loginAttempts,
+	)
+	// Report every outcome from the start, so rates work before the first event
+	for _, outcome := range []string{ContactSaved, ContactSpam, ContactFailed} {
+		contactSubmissions.WithLabelValues(outcome)
+	}
+	for _, result := range []string{"success", "failure"} {
+		emailsSent.WithLabelValues(result)
+	}
+	for _, result := range []string{LoginSuccess, LoginMFARequired, LoginInvalidCredentials, LoginThrottled, LoginForbidden, LoginError} {
+		loginAttempts.WithLabelValues(result)
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveRequest records a handled HTTP request. route is the route pattern,
+// such as /api/events/:id, so the number of series stays bounded.
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ContactSubmission records a contact form submission with its outcome
+func ContactSubmission(outcome string) {
+	contactSubmissions.WithLabelValues(outcome).Inc()
+}
+
+// EmailSent records the result of sending an email
+func EmailSent(err error) {
+	if err != nil {
+		emailsSent.WithLabelValues("failure").Inc()
+		return
+	}
+	emailsSent.WithLabelValues("success").Inc()
+}
+
+// EmailQueued counts an email waiting to be sent in the background; call the
+// returned function once it has been sent or given up
+func EmailQueued() (done func()) {
+	emailQueueDepth.Add(1)
+	return func() { emailQueueDepth.Add(-1) }
+}
+
+// EmailQueueDepth returns the number of emails waiting to be sent
+func EmailQueueDepth() int64 {
+	return emailQueueDepth.Load()
+}
+
+// LoginAttempt records the result of a login attempt
+func LoginAttempt(result string) {
+	loginAttempts.WithLabelValues(result).Inc()
+}
+
+// RegisterDatabase reports the statistics of the connection pool and whether
+// the database is reachable
+func RegisterDatabase(db *sql.DB, available func() bool) {
+	Registry.MustRegister(
+		collectors.NewDBStatsCollector(db, "postgres"),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "database_up",
+			Help: "Whether the database is reachable (1) or not (0).",
+		}, func() float64 {
+			if available() {
+				return 1
+			}
+			return 0
+		}),
+	)
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"manage/internal/apierror"
+	"manage/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyAuthenticator validates API keys used by scripts and integrations
+type APIKeyAuthenticator interface {
+	// AuthenticateAPIKey returns the principal of the key, or nil for unknown,
+	// expired or revoked keys; err reports lookup failures.
+	AuthenticateAPIKey(ctx context.Context, key, ipAddress string) (*models.APIKeyPrincipal, error)
+}
+
+// extractAPIKey returns the API key from the X-API-Key header, or from a
+// Bearer token that carries an API key instead of a JWT
+func extractAPIKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if token := extractToken(c); strings.HasPrefix(token, models.APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// authenticateAPIKey validates an API key and stores claims whose permissions
+// are the key's scopes. It reports whether the request may continue.
+func authenticateAPIKey(c *gin.Context, apiKeys APIKeyAuthenticator, key string) bool {
+	if apiKeys == nil {
+		abort(c, apierror.Unauthorized("API keys are not accepted"))
+		return false
+	}
+
+	principal, err := apiKeys.AuthenticateAPIKey(c.Request.Context(), key, c.ClientIP())
+	if err != nil {
+		c.Header("Retry-After", "30")
+		abort(c, apierror.Unavailable("Unable to verify API key").Wrap(err))
+		return false
+	}
+	if principal == nil || len(principal.Scopes) == 0 {
+		abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired API key"))
+		return false
+	}
+
+	c.Set("user", &Auth0Claims{
+		Sub:         principal.Subject,
+		Permissions: principal.Scopes,
+		IsAPIKey:    true,
+		APIKeySite:  principal.SiteID,
+	})
+	return true
+}
+
+// RequireUser rejects requests authenticated with an API key, for endpoints
+// that act on the account of a person, such as sessions and 2FA. It must run
+// after Auth0Middleware.
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("user")
+		if claims, ok := value.(*Auth0Claims); ok && claims.IsAPIKey {
+			abort(c, apierror.New(http.StatusForbidden, apierror.CodeAPIKeyNotAllowed, "API keys cannot access this endpoint"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"manage/internal/apierror"
+	"manage/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys under which handlers leave details for the audit log
+const (
+	auditTargetKey  = "audit_target"
+	auditBeforeKey  = "audit_before"
+	auditAfterKey   = "audit_after"
+	auditDetailsKey = "audit_details"
+	auditBufferKey  = "audit_buffer"
+)
+
+// AuditRecorder stores audit log entries
+type AuditRecorder interface {
+	Record(ctx context.Context, entry *models.AuditLog) error
+}
+
+// Audit records every request that passes through it in the audit log: the
+// actor, the route, the target record, the client IP and the response status.
+// Handlers add before/after snapshots with AuditBefore and AuditAfter. It must
+// run after Auth0Middleware. Responses of routes marked with PersonalData are
+// only sent once their entry is stored.
+func Audit(recorder AuditRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		actor := ""
+		if value, exists := c.Get("user"); exists {
+			if claims, ok := value.(*Auth0Claims); ok {
+				actor = claims.Sub
+			}
+		}
+
+		ipAddress := c.ClientIP()
+		entry := &models.AuditLog{
+			SiteID:     CurrentSite(c),
+			Actor:      actor,
+			Action:     c.Request.Method + " " + c.FullPath(),
+			TargetType: auditTargetType(c.FullPath()),
+			TargetID:   auditTargetID(c),
+			Status:     responseStatus(c),
+			IPAddress:  &ipAddress,
+			Before:     auditSnapshot(c, auditBeforeKey),
+			After:      auditSnapshot(c, auditAfterKey),
+			Details:    auditSnapshot(c, auditDetailsKey),
+		}
+
+		// The entry is recorded with a context that outlives a client disconnect
+		err := recorder.Record(context.WithoutCancel(c.Request.Context()), entry)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to record audit log entry", "action", entry.Action, "error", err)
+		}
+
+		value, _ := c.Get(auditBufferKey)
+		if buffer, ok := value.(*auditBuffer); ok {
+			c.Writer = buffer.ResponseWriter
+			if err != nil {
+				// Personal data is never sent without a trace in the audit log
+				c.Header("Retry-After", "30")
+				c.Error(apierror.Unavailable("The request could not be recorded in the audit log").Wrap(err))
+				return
+			}
+			buffer.flush()
+		}
+	}
+}
+
+// PersonalData marks a route that returns personal data, such as contact
+// requests. Its response is held back until Audit has stored the entry of the
+// request and replaced with 503 if that fails. It must run after Audit.
+func PersonalData() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		buffer := &auditBuffer{ResponseWriter: c.Writer, header: http.Header{}, status: http.StatusOK}
+		c.Writer = buffer
+		c.Set(auditBufferKey, buffer)
+		c.Next()
+	}
+}
+
+// auditBuffer holds back a response until it may be sent
+type auditBuffer struct {
+	gin.ResponseWriter
+
+	header  http.Header
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (b *auditBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *auditBuffer) WriteHeader(status int) {
+	if status > 0 && !b.written {
+		b.status = status
+	}
+}
+
+func (b *auditBuffer) WriteHeaderNow() {
+	b.written = true
+}
+
+func (b *auditBuffer) Write(data []byte) (int, error) {
+	b.written = true
+	return b.body.Write(data)
+}
+
+func (b *auditBuffer) WriteString(s string) (int, error) {
+	b.written = true
+	return b.body.WriteString(s)
+}
+
+func (b *auditBuffer) Status() int {
+	return b.status
+}
+
+func (b *auditBuffer) Size() int {
+	if !b.written {
+		return -1
+	}
+	return b.body.Len()
+}
+
+func (b *auditBuffer) Written() bool {
+	return b.written
+}
+
+// Flush is a no-op; the response is sent by flush
+func (b *auditBuffer) Flush() {}
+
+// flush sends the held back response, if the handler wrote one
+func (b *auditBuffer) flush() {
+	if !b.written {
+		return
+	}
+	for key, values := range b.header {
+		b.ResponseWriter.Header()[key] = values
+	}
+	b.ResponseWriter.WriteHeader(b.status)
+	b.ResponseWriter.WriteHeaderNow()
+	b.ResponseWriter.Write(b.body.Bytes())
+}
+
+// responseStatus returns the status of the response, including errors that
+// Errors has yet to write
+func responseStatus(c *gin.Context) int {
+	if !c.Writer.Written() && len(c.Errors) > 0 {
+		return apierror.From(c.Errors.Last().Err).Status
+	}
+	return c.Writer.Status()
+}
+
+// AuditTarget sets the ID of the record a request acted on, e.g. of a record
+// that was just created. By default the :id route parameter is used.
+func AuditTarget(c *gin.Context, id interface{}) {
+	c.Set(auditTargetKey, fmt.Sprint(id))
+}
+
+// AuditBefore records the state of the target before the request changed it.
+// The value is serialized immediately, so it may be modified afterwards.
+func AuditBefore(c *gin.Context, value interface{}) {
+	setAuditSnapshot(c, auditBeforeKey, value)
+}
+
+// AuditAfter records the state of the target after the request changed it
+func AuditAfter(c *gin.Context, value interface{}) {
+	setAuditSnapshot(c, auditAfterKey, value)
+}
+
+// AuditDetail adds further information to the audit log entry of the request,
+// such as which records a list endpoint returned
+func AuditDetail(c *gin.Context, key string, value interface{}) {
+	details, _ := c.Get(auditDetailsKey)
+	snapshot, _ := details.(models.JSONB)
+	if snapshot == nil {
+		snapshot = models.JSONB{}
+	}
+	snapshot[key] = value
+	c.Set(auditDetailsKey, snapshot)
+}
+
+// setAuditSnapshot stores the JSON representation of value in the context
+func setAuditSnapshot(c *gin.Context, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		logger.WarnContext(c.Request.Context(), "Failed to serialize audit snapshot", "error", err)
+		return
+	}
+
+	var snapshot models.JSONB
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		logger.WarnContext(c.Request.Context(), "Audit snapshot is not a JSON object", "error", err)
+		return
+	}
+	c.Set(key, snapshot)
+}
+
+// auditSnapshot returns a snapshot stored by the handler, or nil
+func auditSnapshot(c *gin.Context, key string) models.JSONB {
+	value, _ := c.Get(key)
+	snapshot, _ := value.(models.JSONB)
+	return snapshot
+}
+
+// auditTargetID returns the target set by the handler or the :id route parameter
+func auditTargetID(c *gin.Context) *string {
+	if value, exists := c.Get(auditTargetKey); exists {
+		if id, ok := value.(string); ok {
+			return &id
+		}
+	}
+	if id := c.Param("id"); id != "" {
+		return &id
+	}
+	return nil
+}
+
+// auditTargetType derives the kind of record from the route, e.g.
+// "contact-requests" for /api/contact-requests/:id
+func auditTargetType(route string) string {
+	segments := strings.Split(strings.TrimPrefix(route, "/api/"), "/")
+	if segments[0] == "auth" && len(segments) > 1 {
+		return "auth/" + segments[1]
+	}
+	return segments[0]
+}
@@ -0,0 +1,117 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"manage/internal/apierror"
+	"manage/internal/middleware"
+	"manage/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRecorder keeps audit entries in memory, or fails when err is set
+type fakeRecorder struct {
+	entries []*models.AuditLog
+	err     error
+}
+
+func (r *fakeRecorder) Record(ctx context.Context, entry *models.AuditLog) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+// newAuditedEngine serves a contact request marked as personal data and one
+// that is not found, both behind Audit
+func newAuditedEngine(recorder middleware.AuditRecorder) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Errors(), middleware.Audit(recorder))
+	r.GET("/api/contact-requests/:id", middleware.PersonalData(), func(c *gin.Context) {
+		if c.Param("id") != "1" {
+			c.Error(apierror.NotFound("Contact request not found"))
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"email": "anna@example.com"})
+	})
+	r.GET("/api/events", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"events": []string{}})
+	})
+	return r
+}
+
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestAuditSendsPersonalDataAfterRecording(t *testing.T) {
+	recorder := &fakeRecorder{}
+	w := get(newAuditedEngine(recorder), "/api/contact-requests/1")
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "anna@example.com") {
+		t.Fatalf("got %d %s, want the contact request", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want the header set by the handler", got)
+	}
+	if len(recorder.entries) != 1 {
+		t.Fatalf("recorded %d entries, want 1", len(recorder.entries))
+	}
+	entry := recorder.entries[0]
+	if entry.Action != "GET /api/contact-requests/:id" || entry.TargetID == nil || *entry.TargetID != "1" || entry.Status != http.StatusOK {
+		t.Errorf("recorded %+v", entry)
+	}
+}
+
+func TestAuditWithholdsPersonalDataWhenRecordingFails(t *testing.T) {
+	recorder := &fakeRecorder{err: errors.New("connection refused")}
+	w := get(newAuditedEngine(recorder), "/api/contact-requests/1")
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "anna@example.com") {
+		t.Error("personal data was sent although the audit entry was not stored")
+	}
+	if strings.Contains(w.Body.String(), "connection refused") {
+		t.Error("the cause of the failure was sent to the client")
+	}
+	if got := w.Header().Get("Content-Type"); got != apierror.ContentType {
+		t.Errorf("Content-Type = %q, want a problem", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("headers of the withheld response were sent: Cache-Control = %q", got)
+	}
+}
+
+func TestAuditRecordsStatusOfErrors(t *testing.T) {
+	recorder := &fakeRecorder{}
+	w := get(newAuditedEngine(recorder), "/api/contact-requests/2")
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want 404", w.Code)
+	}
+	if len(recorder.entries) != 1 || recorder.entries[0].Status != http.StatusNotFound {
+		t.Errorf("recorded %+v, want one entry with status 404", recorder.entries)
+	}
+}
+
+func TestAuditFailureDoesNotBlockOtherRoutes(t *testing.T) {
+	recorder := &fakeRecorder{err: errors.New("connection refused")}
+	w := get(newAuditedEngine(recorder), "/api/events")
+
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, want 200 for a route without personal data", w.Code)
+	}
+}
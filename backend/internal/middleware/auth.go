@@ -1,68 +1,115 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
+	"manage/internal/apierror"
+	"manage/internal/config"
+	"manage/internal/permissions"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // Auth0Claims represents the JWT claims from Auth0
 type Auth0Claims struct {
-	Sub         string                 `json:"sub"`
-	Email       string                 `json:"email"`
-	AppMetadata map[string]interface{} `json:"https://your-namespace.com/app_metadata"`
+	Sub   string `json:"sub"`
+	Email string `json:"email"`
+	// AppMetadata is the object under the configured claims namespace
+	AppMetadata map[string]interface{} `json:"-"`
+	// Permissions granted to the user, as issued by this API or by Auth0 RBAC
+	Permissions []string `json:"permissions,omitempty"`
+	// SessionID links tokens issued by this API to the login session they belong to
+	SessionID string `json:"sid,omitempty"`
+	// Purpose is set on tokens that are only valid for one step, such as the
+	// second factor of a login; they are never accepted as access tokens
+	Purpose string `json:"purpose,omitempty"`
+	// IsAPIKey is set when the request was authenticated with an API key, whose
+	// scopes are then the permissions. It is never read from a token.
+	IsAPIKey bool `json:"-"`
+	// APIKeySite is the site an API key belongs to
+	APIKeySite string `json:"-"`
 	jwt.RegisteredClaims
+
+	// raw holds every claim of the token for the configured claims mapping
+	raw map[string]interface{}
+}
+
+// Roles returns the roles found at the role claims of the mapping, supporting
+// both a single "role" and a "roles" list in the app metadata
+func (claims *Auth0Claims) Roles() []string {
+	return claimStrings(claims.raw, DefaultClaimsMapping().rolePaths())
+}
+
+// Sites returns the sites found at the site claims of the mapping, or the
+// site of an API key
+func (claims *Auth0Claims) Sites() []string {
+	if claims.IsAPIKey {
+		return []string{claims.APIKeySite}
+	}
+	return claimStrings(claims.raw, DefaultClaimsMapping().sitePaths())
+}
+
+// EffectivePermissions returns the permissions carried by the token. Tokens
+// issued before permissions existed are resolved from their roles and sites.
+func (claims *Auth0Claims) EffectivePermissions() []string {
+	if len(claims.Permissions) > 0 {
+		return claims.Permissions
+	}
+	return permissions.Default().Resolve(claims.Roles(), claims.Sites(), config.Get().Site.ID)
+}
+
+// RevocationChecker reports whether a login session has been revoked, e.g. by
+// logout or "sign out everywhere"
+type RevocationChecker interface {
+	IsRevoked(sessionID string) (bool, error)
 }
 
-// Auth0Middleware handles Auth0 JWT validation and user authorization
-func Auth0Middleware() gin.HandlerFunc {
+// Auth0Middleware handles Auth0 JWT validation and user authorization. Tokens
+// that belong to a revoked session are rejected even before they expire.
+// Instead of a JWT, scripts may send an API key, whose scopes are enforced
+// by RequirePermission like the permissions of a user.
+func Auth0Middleware(revocations RevocationChecker, apiKeys APIKeyAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := extractAPIKey(c); key != "" {
+			if authenticateAPIKey(c, apiKeys, key) {
+				c.Next()
+			}
+			return
+		}
+
 		// Extract token from Authorization header
 		tokenString := extractToken(c)
 		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-			c.Abort()
+			abort(c, apierror.Unauthorized("Authorization token required"))
 			return
 		}
 
-		// Get secret key from environment
-		secretKey := os.Getenv("JWT_SECRET")
-		if secretKey == "" {
-			secretKey = "your-secret-key" // Fallback for development
-		}
-
-		// Parse and validate the token
-		token, err := jwt.ParseWithClaims(tokenString, &Auth0Claims{}, func(token *jwt.Token) (interface{}, error) {
-			// Verify the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			return []byte(secretKey), nil
-		})
-
+		// Parse and validate the token (HS256 issued by us, or RS256 issued by Auth0)
+		claims, err := defaultTokenValidator().Validate(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
-			c.Abort()
+			abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired token").Wrap(err))
 			return
 		}
 
-		// Extract claims
-		claims, ok := token.Claims.(*Auth0Claims)
-		if !ok || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
-			return
+		// Reject tokens of sessions that were logged out
+		if claims.SessionID != "" && revocations != nil {
+			revoked, err := revocations.IsRevoked(claims.SessionID)
+			if err != nil {
+				c.Header("Retry-After", "30")
+				abort(c, apierror.Unavailable("Unable to verify session").Wrap(err))
+				return
+			}
+			if revoked {
+				abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeSessionRevoked, "Session has been revoked"))
+				return
+			}
 		}
 
 		// Check authorization based on app metadata
 		if !isAuthorized(claims) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-			c.Abort()
+			abort(c, apierror.New(http.StatusForbidden, apierror.CodeInsufficientPermissions, "Insufficient permissions"))
 			return
 		}
 
@@ -88,35 +135,14 @@ func extractToken(c *gin.Context) string {
 	return parts[1]
 }
 
-// isAuthorized checks if the user has permission to access the admin panel
+// isAuthorized checks if the user has permission to access the admin panel,
+// i.e. holds at least one permission
 func isAuthorized(claims *Auth0Claims) bool {
-	siteID := os.Getenv("SITE_ID")
-
-	// Check if user has admin role
-	if role, exists := claims.AppMetadata["role"]; exists {
-		if roleStr, ok := role.(string); ok && roleStr == "admin" {
-			return true
-		}
-	}
-
-	// Check if user has site access if SITE_ID is configured
-	if siteID != "" {
-		if sites, exists := claims.AppMetadata["sites"]; exists {
-			if sitesList, ok := sites.([]interface{}); ok {
-				for _, site := range sitesList {
-					if siteStr, ok := site.(string); ok && siteStr == siteID {
-						return true
-					}
-				}
-			}
-		}
-	}
-
-	return false
+	return len(claims.EffectivePermissions()) > 0
 }
 
 // OptionalAuth middleware for public routes that don't require authentication
-func OptionalAuth() gin.HandlerFunc {
+func OptionalAuth(revocations RevocationChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := extractToken(c)
 		if tokenString == "" {
@@ -124,18 +150,13 @@ func OptionalAuth() gin.HandlerFunc {
 			return
 		}
 
-		secretKey := os.Getenv("JWT_SECRET")
-		if secretKey == "" {
-			secretKey = "your-secret-key"
-		}
-
 		// Try to parse token, but don't fail if invalid
-		token, err := jwt.ParseWithClaims(tokenString, &Auth0Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		})
-
-		if err == nil && token.Valid {
-			if claims, ok := token.Claims.(*Auth0Claims); ok {
+		if claims, err := defaultTokenValidator().Validate(tokenString); err == nil {
+			revoked := false
+			if claims.SessionID != "" && revocations != nil {
+				revoked, err = revocations.IsRevoked(claims.SessionID)
+			}
+			if err == nil && !revoked {
 				c.Set("user", claims)
 			}
 		}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"manage/internal/config"
+	"manage/internal/permissions"
+)
+
+// LegacyClaimsNamespace is the claim that held the app metadata before the
+// namespace became configurable. Tokens carrying it are still understood.
+const LegacyClaimsNamespace = "https://your-namespace.com/app_metadata"
+
+// ClaimsMapping tells where roles, sites and permissions are found in a token.
+// Claim paths are dot-separated, and a segment may itself contain dots, so
+// "https://example.org/app_metadata.roles" reads "roles" from the
+// "https://example.org/app_metadata" claim.
+type ClaimsMapping struct {
+	// Namespace is the claim holding the app metadata ("role", "roles" and
+	// "sites"). Tokens issued by this API write it.
+	Namespace string
+	// RoleClaims and SiteClaims are read in addition to the namespace, e.g. a
+	// roles claim added to Auth0 access tokens by an Action
+	RoleClaims []string
+	SiteClaims []string
+	// PermissionClaims hold permissions directly, such as the "permissions"
+	// array of Auth0 RBAC
+	PermissionClaims []string
+}
+
+var (
+	claimsMappingOnce sync.Once
+	claimsMapping     ClaimsMapping
+)
+
+// DefaultClaimsMapping returns the mapping configured by AUTH_CLAIMS_NAMESPACE,
+// AUTH_ROLES_CLAIMS, AUTH_SITES_CLAIMS and AUTH_PERMISSIONS_CLAIMS
+func DefaultClaimsMapping() ClaimsMapping {
+	claimsMappingOnce.Do(func() {
+		claimsMapping = ClaimsMappingFromConfig(config.Get().Auth)
+	})
+	return claimsMapping
+}
+
+// ClaimsMappingFromConfig builds the claims mapping from the auth settings
+func ClaimsMappingFromConfig(cfg config.AuthConfig) ClaimsMapping {
+	mapping := ClaimsMapping{
+		Namespace:        cfg.ClaimsNamespace,
+		RoleClaims:       cfg.RolesClaims,
+		SiteClaims:       cfg.SitesClaims,
+		PermissionClaims: cfg.PermissionsClaims,
+	}
+	if mapping.Namespace == "" {
+		mapping.Namespace = LegacyClaimsNamespace
+	}
+	if len(mapping.PermissionClaims) == 0 {
+		mapping.PermissionClaims = []string{"permissions"}
+	}
+	return mapping
+}
+
+// rolePaths returns the claim paths holding roles: the namespace first, so the
+// primary role of tokens issued by this API comes first, then the configured
+// claims and finally the legacy namespace
+func (m ClaimsMapping) rolePaths() []string {
+	paths := []string{m.Namespace + ".role", m.Namespace + ".roles"}
+	paths = append(paths, m.RoleClaims...)
+	return append(paths, LegacyClaimsNamespace+".role", LegacyClaimsNamespace+".roles")
+}
+
+// sitePaths returns the claim paths holding sites
+func (m ClaimsMapping) sitePaths() []string {
+	paths := []string{m.Namespace + ".sites"}
+	paths = append(paths, m.SiteClaims...)
+	return append(paths, LegacyClaimsNamespace+".sites")
+}
+
+// UnmarshalJSON decodes the registered claims and resolves the app metadata and
+// permissions through the configured claims mapping
+func (claims *Auth0Claims) UnmarshalJSON(data []byte) error {
+	type plainClaims Auth0Claims
+	if err := json.Unmarshal(data, (*plainClaims)(claims)); err != nil {
+		return err
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	claims.raw = raw
+
+	mapping := DefaultClaimsMapping()
+	if metadata, ok := raw[mapping.Namespace].(map[string]interface{}); ok {
+		claims.AppMetadata = metadata
+	} else if metadata, ok := raw[LegacyClaimsNamespace].(map[string]interface{}); ok {
+		claims.AppMetadata = metadata
+	}
+
+	// Only permissions of this API count; Auth0 may list those of other APIs too
+	claims.Permissions = nil
+	for _, perm := range claimStrings(raw, mapping.PermissionClaims) {
+		if permissions.IsKnown(perm) {
+			claims.Permissions = append(claims.Permissions, perm)
+		}
+	}
+	// With RBAC, Auth0 also grants permissions requested as scopes
+	if scope, ok := raw["scope"].(string); ok {
+		for _, perm := range strings.Fields(scope) {
+			if permissions.IsKnown(perm) && !containsString(claims.Permissions, perm) {
+				claims.Permissions = append(claims.Permissions, perm)
+			}
+		}
+	}
+
+	return nil
+}
+
+// claimStrings collects the strings found at the given claim paths, without
+// duplicates. A claim may be a single string or an array of strings.
+func claimStrings(raw map[string]interface{}, paths []string) []string {
+	result := []string{}
+	for _, path := range paths {
+		value, ok := lookupClaim(raw, path)
+		if !ok {
+			continue
+		}
+
+		var values []string
+		if str, ok := value.(string); ok && str != "" {
+			values = []string{str}
+		} else {
+			values = toStringSlice(value)
+		}
+		for _, str := range values {
+			if !containsString(result, str) {
+				result = append(result, str)
+			}
+		}
+	}
+	return result
+}
+
+// lookupClaim resolves a dot-separated path, preferring the longest claim name
+// that exists, since namespaced claims are URLs containing dots
+func lookupClaim(claims map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := claims[path]; ok {
+		return value, true
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i] != '.' {
+			continue
+		}
+		if nested, ok := claims[path[:i]].(map[string]interface{}); ok {
+			if value, ok := lookupClaim(nested, path[i+1:]); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"manage/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// databaseRetryAfter is the Retry-After, in seconds, of responses sent while
+// the database is unavailable
+const databaseRetryAfter = "10"
+
+// RequireDatabase answers requests with 503 while the database is unavailable
+// instead of letting every handler fail on its own
+func RequireDatabase(available func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !available() {
+			DatabaseUnavailable(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// DatabaseUnavailable aborts a request with 503 and a Retry-After header
+func DatabaseUnavailable(c *gin.Context) {
+	c.Header("Retry-After", databaseRetryAfter)
+	abort(c, apierror.New(http.StatusServiceUnavailable, apierror.CodeDatabaseUnavailable, "Database connection not available"))
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"manage/internal/apierror"
+	"manage/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Errors writes the last error a handler or middleware added with c.Error as
+// an RFC 7807 problem. Errors other than *apierror.Error become a generic 500,
+// so messages of the database or Auth0 never reach the client; the cause is
+// logged in the access log line of the request instead. It must run before
+// Recovery, so panics are answered with a problem too.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := apierror.From(c.Errors.Last().Err)
+		c.Header("Content-Type", apierror.ContentType)
+		c.JSON(err.Status, err.Problem(c.Request.URL.Path, logging.RequestID(c.Request.Context())))
+	}
+}
+
+// NotFound answers requests to routes that do not exist
+func NotFound() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Error(apierror.NotFound("No route matches " + c.Request.Method + " " + c.Request.URL.Path))
+	}
+}
+
+// abort stops the request with an error that Errors writes
+func abort(c *gin.Context, err *apierror.Error) {
+	c.Error(err)
+	c.Abort()
+}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"manage/internal/tracing"
+)
+
+const (
+	// jwksCacheTTL is how long fetched keys are trusted before the set is refreshed
+	jwksCacheTTL = 10 * time.Minute
+	// jwksMinRefreshInterval is the default limit on refetches triggered by unknown key IDs
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+// JSONWebKey represents a single key of a JSON Web Key Set
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JSONWebKeySet represents the document served at a JWKS endpoint
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKSCache fetches and caches the RSA signing keys of an identity provider.
+// Keys are refreshed after jwksCacheTTL, and immediately (rate limited) when a
+// token references a key ID we have not seen yet, so key rotation is picked up.
+type JWKSCache struct {
+	url                string
+	client             *http.Client
+	minRefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKSCache creates a new JWKS cache for the given endpoint. minRefreshInterval
+// limits how often unknown key IDs trigger a refetch; zero uses the default.
+func NewJWKSCache(url string, minRefreshInterval time.Duration) *JWKSCache {
+	if minRefreshInterval <= 0 {
+		minRefreshInterval = jwksMinRefreshInterval
+	}
+	return &JWKSCache{
+		url:                url,
+		client:             &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(nil)},
+		minRefreshInterval: minRefreshInterval,
+		keys:               map[string]*rsa.PublicKey{},
+	}
+}
+
+// Key returns the public key with the given key ID, refreshing the set when needed
+func (jc *JWKSCache) Key(kid string) (*rsa.PublicKey, error) {
+	jc.mu.RLock()
+	key, ok := jc.keys[kid]
+	fresh := time.Since(jc.fetchedAt) < jwksCacheTTL
+	jc.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := jc.refresh(); err != nil {
+		// Keep serving known keys if the provider is temporarily unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	jc.mu.RLock()
+	defer jc.mu.RUnlock()
+	if key, ok := jc.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refresh refetches the key set unless another refresh happened very recently
+func (jc *JWKSCache) refresh() error {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+
+	if time.Since(jc.lastAttempt) < jc.minRefreshInterval {
+		return nil
+	}
+	jc.lastAttempt = time.Now()
+
+	keys, err := jc.fetch()
+	if err != nil {
+		return err
+	}
+
+	jc.keys = keys
+	jc.fetchedAt = time.Now()
+	return nil
+}
+
+// fetch downloads and parses the key set
+func (jc *JWKSCache) fetch() (map[string]*rsa.PublicKey, error) {
+	resp, err := jc.client.Get(jc.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.RSAPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no RSA signing keys")
+	}
+
+	return keys, nil
+}
+
+// RSAPublicKey decodes the modulus and exponent of an RSA key
+func (jwk JSONWebKey) RSAPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported exponent")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+// NewJSONWebKey encodes an RSA public key as a JSON Web Key
+func NewJSONWebKey(kid string, key *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
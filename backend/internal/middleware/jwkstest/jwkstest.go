@@ -0,0 +1,102 @@
+// Package jwkstest provides a local stand-in for an identity provider's JWKS
+// endpoint, so RS256 token validation can be exercised without Auth0.
+package jwkstest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"manage/internal/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Server serves a JSON Web Key Set and signs tokens with the matching private keys
+type Server struct {
+	*httptest.Server
+
+	mu   sync.RWMutex
+	keys []signingKey
+}
+
+type signingKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+// NewServer starts a JWKS server with a single signing key
+func NewServer() (*Server, error) {
+	s := &Server{}
+	if err := s.Rotate(); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", s.serveJWKS)
+	s.Server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// Issuer returns the issuer URL tokens from this server should carry
+func (s *Server) Issuer() string {
+	return s.URL + "/"
+}
+
+// JWKSURL returns the URL of the key set
+func (s *Server) JWKSURL() string {
+	return s.URL + "/.well-known/jwks.json"
+}
+
+// Rotate generates a new current signing key. Previous keys stay published so
+// tokens signed before the rotation remain valid.
+func (s *Server) Rotate() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, signingKey{
+		kid: fmt.Sprintf("key-%d", len(s.keys)+1),
+		key: key,
+	})
+	return nil
+}
+
+// RetireOldKeys stops publishing every key except the current one
+func (s *Server) RetireOldKeys() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = s.keys[len(s.keys)-1:]
+}
+
+// Sign signs the claims with the current key using RS256
+func (s *Server) Sign(claims jwt.Claims) (string, error) {
+	s.mu.RLock()
+	current := s.keys[len(s.keys)-1]
+	s.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = current.kid
+	return token.SignedString(current.key)
+}
+
+// serveJWKS writes the public halves of all published keys
+func (s *Server) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	set := middleware.JSONWebKeySet{}
+	for _, k := range s.keys {
+		set.Keys = append(set.Keys, middleware.NewJSONWebKey(k.kid, &k.key.PublicKey))
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
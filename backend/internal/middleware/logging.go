@@ -1,25 +1,98 @@
 package middleware
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
 	"time"
 
+	"manage/internal/apierror"
+	"manage/internal/logging"
+
 	"github.com/gin-gonic/gin"
 )
 
-// Logger returns a gin.HandlerFunc for logging requests
+// RequestIDHeader carries the ID that ties the log lines of a request together
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern accepts IDs from proxies such as UUIDs; others are replaced
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+var (
+	logger    = logging.For("middleware")
+	accessLog = logging.For("http")
+)
+
+// RequestID takes the request ID from the X-Request-ID header or generates
+// one, returns it in the response and adds it to every log line of the request
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Logger writes an access log line for every request: server errors at error
+// level, client errors as warnings
 func Logger() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-			param.ClientIP,
-			param.TimeStamp.Format(time.RFC1123),
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.ErrorMessage,
-		)
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", milliseconds(time.Since(start))),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if errs := c.Errors.ByType(gin.ErrorTypePrivate).String(); errs != "" {
+			attrs = append(attrs, slog.String("error", errs))
+		}
+		accessLog.LogAttrs(c.Request.Context(), level, "Request", attrs...)
+	}
+}
+
+// milliseconds converts a duration for log lines
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Recovery answers panicking requests with a 500 problem and logs the panic
+// with its stack trace and request ID
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, recovered interface{}) {
+		logger.ErrorContext(c.Request.Context(), "Panic while handling request",
+			"panic", recovered, "stack", string(debug.Stack()))
+		abort(c, apierror.Internal("An unexpected error occurred", nil))
 	})
 }
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"manage/internal/apierror"
+	"manage/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the count and latency of every request by route pattern;
+// requests matching no route are counted as "unmatched"
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// RequireBearerToken lets only requests with the given Bearer token pass,
+// e.g. the scraper of /metrics. An empty token lets every request pass.
+func RequireBearerToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(extractToken(c)), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			abort(c, apierror.Unauthorized("Invalid or missing token"))
+			return
+		}
+		c.Next()
+	}
+}
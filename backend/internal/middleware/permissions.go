@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"manage/internal/apierror"
+	"manage/internal/permissions"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission only lets requests through whose token grants all of the
+// given permissions. It must run after Auth0Middleware.
+func RequirePermission(required ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("user")
+		claims, ok := value.(*Auth0Claims)
+		if !exists || !ok {
+			abort(c, apierror.Unauthorized("User not authenticated"))
+			return
+		}
+
+		if !permissions.HasAll(claims.EffectivePermissions(), required...) {
+			abort(c, apierror.New(http.StatusForbidden, apierror.CodeInsufficientPermissions, "Insufficient permissions").
+				With("required", required))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// toStringSlice converts a decoded JSON array into a string slice, skipping non-strings
+func toStringSlice(value interface{}) []string {
+	result := []string{}
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"manage/internal/apierror"
+	"manage/internal/config"
+	"manage/internal/permissions"
+	"manage/internal/tenancy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SiteHeader selects the site of an authenticated request, e.g. for admins
+// of several congregations. "*" selects every site.
+const SiteHeader = "X-Site-ID"
+
+// Context keys under which the resolved site is stored
+const (
+	siteKey         = "site_id"
+	siteFromHostKey = "site_from_host"
+)
+
+// SiteResolver looks up the sites sharing this deployment
+type SiteResolver interface {
+	// SiteForHost returns the site a host name belongs to; ok is false for
+	// hosts that are not assigned to a site
+	SiteForHost(ctx context.Context, host string) (siteID string, ok bool, err error)
+	SiteExists(ctx context.Context, siteID string) (bool, error)
+}
+
+// Tenant resolves the site of a request from its Host header, falling back to
+// the default site (SITE_ID), and stores it in the request context, where it scopes all queries
+// on tenant data
+func Tenant(resolver SiteResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		siteID, ok, err := resolver.SiteForHost(c.Request.Context(), c.Request.Host)
+		if err != nil {
+			c.Header("Retry-After", "30")
+			abort(c, apierror.Unavailable("Unable to resolve site").Wrap(err))
+			return
+		}
+		if !ok {
+			siteID = config.Get().Site.ID
+		}
+
+		c.Set(siteFromHostKey, ok)
+		setSite(c, siteID)
+		c.Next()
+	}
+}
+
+// RequireSiteAccess picks the site of an authenticated request and checks
+// that the caller belongs to it. The site is taken from the X-Site-ID header
+// or ?site=, else from the Host header, else it is the default site or, for
+// callers without access to it, the first site in their token. "*" gives
+// super-admins a read-only view across all sites. It must run after
+// Auth0Middleware and Tenant.
+func RequireSiteAccess(resolver SiteResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("user")
+		claims, ok := value.(*Auth0Claims)
+		if !ok {
+			abort(c, apierror.Unauthorized("User not authenticated"))
+			return
+		}
+
+		siteID := CurrentSite(c)
+		requested := c.GetHeader(SiteHeader)
+		if requested == "" {
+			requested = c.Query("site")
+		}
+
+		switch {
+		case requested == tenancy.AllSites:
+			if !isSuperAdmin(claims) {
+				abort(c, apierror.New(http.StatusForbidden, apierror.CodeSiteAccessDenied, "Only super-admins can view all sites"))
+				return
+			}
+			if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+				abort(c, apierror.BadRequest("Select a single site to make changes"))
+				return
+			}
+			setSite(c, tenancy.AllSites)
+			c.Next()
+			return
+		case requested != "":
+			exists, err := resolver.SiteExists(c.Request.Context(), requested)
+			if err != nil {
+				c.Header("Retry-After", "30")
+				abort(c, apierror.Unavailable("Unable to resolve site").Wrap(err))
+				return
+			}
+			if !exists {
+				abort(c, apierror.NotFound("Site not found"))
+				return
+			}
+			siteID = requested
+		case !c.GetBool(siteFromHostKey):
+			// Without a site-specific host, fall back to a site named in the token
+			if sites := claims.Sites(); len(sites) > 0 && !CanAccessSite(claims, siteID) {
+				siteID = sites[0]
+			}
+		}
+
+		if !CanAccessSite(claims, siteID) {
+			abort(c, apierror.New(http.StatusForbidden, apierror.CodeSiteAccessDenied, "No access to this site"))
+			return
+		}
+
+		setSite(c, siteID)
+		c.Next()
+	}
+}
+
+// CurrentSite returns the site of the request, or "*" for cross-site views
+func CurrentSite(c *gin.Context) string {
+	if siteID := c.GetString(siteKey); siteID != "" {
+		return siteID
+	}
+	return config.Get().Site.ID
+}
+
+// CanAccessSite reports whether the caller may act on the site. Super-admins
+// may access every site; tokens without sites, issued before sites existed,
+// only the default site.
+func CanAccessSite(claims *Auth0Claims, siteID string) bool {
+	if isSuperAdmin(claims) {
+		return true
+	}
+	sites := claims.Sites()
+	if len(sites) == 0 {
+		return siteID == config.Get().Site.ID
+	}
+	return containsString(sites, siteID)
+}
+
+// isSuperAdmin reports whether the caller manages all sites
+func isSuperAdmin(claims *Auth0Claims) bool {
+	return permissions.HasAll(claims.EffectivePermissions(), permissions.SitesAdmin)
+}
+
+// setSite stores the site in the gin and the request context
+func setSite(c *gin.Context, siteID string) {
+	c.Set(siteKey, siteID)
+	c.Request = c.Request.WithContext(tenancy.WithSite(c.Request.Context(), siteID))
+}
@@ -0,0 +1,123 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"manage/internal/apierror"
+	"manage/internal/middleware"
+	"manage/internal/permissions"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeSites knows two sites, each served on its own host
+type fakeSites struct{}
+
+func (fakeSites) SiteForHost(ctx context.Context, host string) (string, bool, error) {
+	switch host {
+	case "site-a.example.org":
+		return "site-a", true, nil
+	case "site-b.example.org":
+		return "site-b", true, nil
+	}
+	return "", false, nil
+}
+
+func (fakeSites) SiteExists(ctx context.Context, siteID string) (bool, error) {
+	return siteID == "site-a" || siteID == "site-b", nil
+}
+
+// claimsFor returns the claims of a token with the given roles and sites
+func claimsFor(t *testing.T, roles, sites []string) *middleware.Auth0Claims {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"sub":                            "auth0|1",
+		middleware.LegacyClaimsNamespace: map[string]interface{}{"roles": roles, "sites": sites},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims middleware.Auth0Claims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return &claims
+}
+
+// requestContactRequests lists contact requests as the caller, answering with
+// the site the request was scoped to
+func requestContactRequests(claims *middleware.Auth0Claims, host, site string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Errors(), middleware.Tenant(fakeSites{}))
+	r.GET("/api/contact-requests",
+		func(c *gin.Context) { c.Set("user", claims) },
+		middleware.RequireSiteAccess(fakeSites{}),
+		middleware.RequirePermission(permissions.ContactRead),
+		func(c *gin.Context) { c.String(http.StatusOK, middleware.CurrentSite(c)) },
+	)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/contact-requests", nil)
+	req.Host = host
+	if site != "" {
+		req.Header.Set(middleware.SiteHeader, site)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSiteAdminIsDeniedOtherSites(t *testing.T) {
+	admin := claimsFor(t, []string{permissions.RoleAdmin}, []string{"site-a"})
+
+	tests := []struct {
+		name string
+		host string
+		site string
+	}{
+		{"selected by header", "api.example.org", "site-b"},
+		{"selected by host", "site-b.example.org", ""},
+		{"all sites", "api.example.org", "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := requestContactRequests(admin, tt.host, tt.site)
+			if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), apierror.CodeSiteAccessDenied) {
+				t.Errorf("got %d %s, want 403 site_access_denied", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSiteAdminReachesOwnSite(t *testing.T) {
+	admin := claimsFor(t, []string{permissions.RoleAdmin}, []string{"site-a"})
+
+	for _, host := range []string{"api.example.org", "site-a.example.org"} {
+		w := requestContactRequests(admin, host, "")
+		if w.Code != http.StatusOK || w.Body.String() != "site-a" {
+			t.Errorf("host %s: got %d %s, want 200 for site-a", host, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestSuperAdminReachesEverySite(t *testing.T) {
+	superAdmin := claimsFor(t, []string{permissions.RoleSuperAdmin}, []string{"site-a"})
+
+	for _, site := range []string{"site-b", "*"} {
+		w := requestContactRequests(superAdmin, "api.example.org", site)
+		if w.Code != http.StatusOK || w.Body.String() != site {
+			t.Errorf("site %s: got %d %s, want 200", site, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAdminRoleDoesNotGrantSitesAdmin(t *testing.T) {
+	if permissions.HasAll(permissions.Default()[permissions.RoleAdmin], permissions.SitesAdmin) {
+		t.Error("the admin role carries sites:admin, which gives every admin access to all sites")
+	}
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/permissions"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenValidatorConfig configures which tokens a TokenValidator accepts
+type TokenValidatorConfig struct {
+	// Secret verifies HS256 tokens issued by this API
+	Secret []byte
+	// Issuer and Audience must match on RS256 tokens issued by Auth0
+	Issuer   string
+	Audience string
+	// JWKSURL is where the Auth0 signing keys are fetched from. RS256 tokens
+	// are rejected when it is empty.
+	JWKSURL string
+	// JWKSRefreshInterval limits refetches of the key set; zero uses the default
+	JWKSRefreshInterval time.Duration
+}
+
+// TokenValidator validates HS256 tokens signed with our secret and RS256
+// access tokens signed by the Auth0 tenant
+type TokenValidator struct {
+	secret   []byte
+	issuer   string
+	audience string
+	jwks     *JWKSCache
+}
+
+// NewTokenValidator creates a new token validator
+func NewTokenValidator(cfg TokenValidatorConfig) *TokenValidator {
+	tv := &TokenValidator{
+		secret:   cfg.Secret,
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+	}
+	if cfg.JWKSURL != "" {
+		tv.jwks = NewJWKSCache(cfg.JWKSURL, cfg.JWKSRefreshInterval)
+	}
+	return tv
+}
+
+var (
+	tokenValidatorOnce sync.Once
+	tokenValidator     *TokenValidator
+)
+
+// defaultTokenValidator returns the validator built from the configuration,
+// shared so the JWKS cache is reused across requests
+func defaultTokenValidator() *TokenValidator {
+	tokenValidatorOnce.Do(func() {
+		tokenValidator = NewTokenValidator(tokenValidatorConfigFromConfig(config.Get()))
+	})
+	return tokenValidator
+}
+
+// tokenValidatorConfigFromConfig builds the validator configuration from the JWT
+// secret and the Auth0 settings
+func tokenValidatorConfigFromConfig(appConfig *config.Config) TokenValidatorConfig {
+	cfg := TokenValidatorConfig{
+		Secret:   []byte(appConfig.Auth.JWTSecret),
+		Audience: appConfig.Auth0.Audience,
+		Issuer:   appConfig.Auth0.Issuer,
+		JWKSURL:  appConfig.Auth0.JWKSURL,
+	}
+
+	if domain := appConfig.Auth0.Domain; domain != "" {
+		if cfg.Issuer == "" {
+			cfg.Issuer = fmt.Sprintf("https://%s/", domain)
+		}
+		if cfg.JWKSURL == "" {
+			cfg.JWKSURL = fmt.Sprintf("https://%s/.well-known/jwks.json", domain)
+		}
+	}
+
+	// Without an audience we cannot tell our API's tokens from any other token
+	// the tenant issues, so Auth0 tokens stay disabled
+	if cfg.Audience == "" {
+		cfg.JWKSURL = ""
+	}
+
+	return cfg
+}
+
+// Validate parses the token and checks its signature and claims
+func (tv *TokenValidator) Validate(tokenString string) (*Auth0Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Auth0Claims{}, tv.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Auth0Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("token cannot be used for API access")
+	}
+
+	// Auth0 access tokens must be issued by our tenant for our API
+	if token.Method == jwt.SigningMethodRS256 {
+		if claims.Issuer != tv.issuer {
+			return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+		}
+		if !containsString(claims.Audience, tv.audience) {
+			return nil, fmt.Errorf("token is not intended for this API")
+		}
+	}
+
+	return claims, nil
+}
+
+// keyFunc selects the verification key based on the token's signing method
+func (tv *TokenValidator) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return tv.secret, nil
+	case *jwt.SigningMethodRSA:
+		if tv.jwks == nil {
+			return nil, fmt.Errorf("RS256 tokens are not accepted: Auth0 audience not configured")
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("token has no key ID")
+		}
+		return tv.jwks.Key(kid)
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+}
+
+// JWTSecret returns the HMAC secret for tokens issued by this API
+func JWTSecret() []byte {
+	return []byte(config.Get().Auth.JWTSecret)
+}
+
+// ValidateAuthConfig checks the role configuration at startup. The secrets are
+// checked when the configuration is loaded.
+func ValidateAuthConfig() error {
+	_, err := permissions.LoadRoles()
+	return err
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package middleware_test
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	"manage/internal/middleware"
+	"manage/internal/middleware/jwkstest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testAudience = "https://api.example.org"
+	testSecret   = "test-secret-that-is-long-enough-for-hs256"
+)
+
+// newTestValidator returns a validator trusting the keys of a fresh JWKS server
+func newTestValidator(t *testing.T) (*middleware.TokenValidator, *jwkstest.Server) {
+	t.Helper()
+	server, err := jwkstest.NewServer()
+	if err != nil {
+		t.Fatalf("start JWKS server: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	validator := middleware.NewTokenValidator(middleware.TokenValidatorConfig{
+		Secret:              []byte(testSecret),
+		Issuer:              server.Issuer(),
+		Audience:            testAudience,
+		JWKSURL:             server.JWKSURL(),
+		JWKSRefreshInterval: time.Millisecond,
+	})
+	return validator, server
+}
+
+// auth0Claims returns the claims of an Auth0 access token for our API
+func auth0Claims(server *jwkstest.Server) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "auth0|1",
+		"iss": server.Issuer(),
+		"aud": []string{testAudience, server.Issuer() + "userinfo"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+func sign(t *testing.T, server *jwkstest.Server, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := server.Sign(claims)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func signHS256(t *testing.T, key []byte, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestTokenValidatorAcceptsAuth0Tokens(t *testing.T) {
+	validator, server := newTestValidator(t)
+
+	claims, err := validator.Validate(sign(t, server, auth0Claims(server)))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if claims.Sub != "auth0|1" {
+		t.Errorf("Validate returned sub %q, want auth0|1", claims.Sub)
+	}
+}
+
+func TestTokenValidatorAcceptsOwnTokens(t *testing.T) {
+	validator, _ := newTestValidator(t)
+
+	token := signHS256(t, []byte(testSecret), jwt.MapClaims{"sub": "local|1", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := validator.Validate(token); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestTokenValidatorFollowsKeyRotation(t *testing.T) {
+	validator, server := newTestValidator(t)
+
+	if _, err := validator.Validate(sign(t, server, auth0Claims(server))); err != nil {
+		t.Fatalf("Validate before rotation: %v", err)
+	}
+
+	// A token with a key ID the validator has not seen yet refetches the set
+	if err := server.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	server.RetireOldKeys()
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := validator.Validate(sign(t, server, auth0Claims(server))); err != nil {
+		t.Fatalf("Validate after rotation: %v", err)
+	}
+}
+
+func TestTokenValidatorRejectsForeignTokens(t *testing.T) {
+	validator, server := newTestValidator(t)
+
+	tests := map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://other-tenant.example.org/" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = []string{"https://other-api.example.org"} },
+		"no audience":    func(c jwt.MapClaims) { delete(c, "aud") },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := auth0Claims(server)
+			modify(claims)
+			if _, err := validator.Validate(sign(t, server, claims)); err == nil {
+				t.Error("Validate accepted the token")
+			}
+		})
+	}
+}
+
+func TestTokenValidatorRefusesAlgorithmConfusion(t *testing.T) {
+	validator, server := newTestValidator(t)
+
+	// An HS256 token "signed" with the published RSA public key must not pass
+	// as an Auth0 token
+	publicKey := publishedKey(t, server)
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	for name, key := range map[string][]byte{"PEM": pemKey, "DER": der} {
+		if _, err := validator.Validate(signHS256(t, key, auth0Claims(server))); err == nil {
+			t.Errorf("Validate accepted an HS256 token signed with the %s public key", name)
+		}
+	}
+
+	// Unsigned tokens are refused
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, auth0Claims(server)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("build unsigned token: %v", err)
+	}
+	if _, err := validator.Validate(unsigned); err == nil {
+		t.Error("Validate accepted an unsigned token")
+	}
+
+	// Without an audience RS256 tokens are not accepted at all
+	ownOnly := middleware.NewTokenValidator(middleware.TokenValidatorConfig{Secret: []byte(testSecret)})
+	if _, err := ownOnly.Validate(sign(t, server, auth0Claims(server))); err == nil {
+		t.Error("Validate accepted an RS256 token without a JWKS URL")
+	}
+}
+
+func TestTokenValidatorRefusesSingleStepTokens(t *testing.T) {
+	validator, server := newTestValidator(t)
+
+	for _, purpose := range []string{"mfa_pending", "magic_link"} {
+		t.Run(purpose, func(t *testing.T) {
+			own := signHS256(t, []byte(testSecret), jwt.MapClaims{
+				"sub":     "local|1",
+				"purpose": purpose,
+				"exp":     time.Now().Add(time.Hour).Unix(),
+			})
+			if _, err := validator.Validate(own); err == nil {
+				t.Error("Validate accepted an HS256 token with a purpose")
+			}
+
+			claims := auth0Claims(server)
+			claims["purpose"] = purpose
+			if _, err := validator.Validate(sign(t, server, claims)); err == nil {
+				t.Error("Validate accepted an RS256 token with a purpose")
+			}
+		})
+	}
+}
+
+// publishedKey returns the current public key from the JWKS endpoint
+func publishedKey(t *testing.T, server *jwkstest.Server) interface{} {
+	t.Helper()
+	resp, err := http.Get(server.JWKSURL())
+	if err != nil {
+		t.Fatalf("fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var set middleware.JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		t.Fatalf("decode JWKS: %v", err)
+	}
+	key, err := set.Keys[len(set.Keys)-1].RSAPublicKey()
+	if err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	return key
+}
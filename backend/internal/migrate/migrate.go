@@ -0,0 +1,335 @@
+// Package migrate applies the SQL migrations embedded in the binary. The schema
+// version is kept in the schema_migrations table used by golang-migrate, so
+// databases migrated by the migrate/migrate container carry on seamlessly.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationLock is the Postgres advisory lock that keeps concurrent
+// deployments from migrating at the same time
+const migrationLock = 0x6d696772 // "migr"
+
+var (
+	// ErrOutdatedSchema is returned when migrations are pending
+	ErrOutdatedSchema = errors.New("database schema is outdated")
+	// ErrDirtySchema is returned when a migration failed halfway. golang-migrate
+	// leaves this state behind; migrations applied by this package run in a
+	// transaction and never do.
+	ErrDirtySchema = errors.New("database schema is dirty after a failed migration")
+	// ErrNoDownMigration is returned when the current version cannot be rolled back
+	ErrNoDownMigration = errors.New("no down migration")
+)
+
+// fileNamePattern matches migration files such as 20251130111236_create_contact_requests.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d{14})_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// namePattern matches names of new migrations
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_]*$`)
+
+// Migration is one schema change with the SQL to apply and to revert it
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes the schema version of a database
+type Status struct {
+	// Current is the applied version, 0 for an empty database
+	Current uint64
+	Dirty   bool
+	// Latest is the newest version known to this binary
+	Latest  uint64
+	Applied []Migration
+	Pending []Migration
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New creates a migrator for the migrations in fsys, e.g. migrations.FS
+func New(db *gorm.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads the migrations in fsys, ordered by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint64]*Migration{}
+	for _, file := range files {
+		match := fileNamePattern.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected YYYYMMDDHHMMSS_name.up.sql or .down.sql", file)
+		}
+		version, _ := strconv.ParseUint(match[1], 10, 64)
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up migration", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Status returns the applied and pending migrations
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	db := m.db.WithContext(ctx)
+	if err := ensureVersionTable(db); err != nil {
+		return nil, err
+	}
+	current, dirty, err := readVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Current: current, Dirty: dirty}
+	for _, migration := range m.migrations {
+		status.Latest = migration.Version
+		if migration.Version <= current {
+			status.Applied = append(status.Applied, migration)
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return status, nil
+}
+
+// Check fails with ErrOutdatedSchema when migrations are pending and with
+// ErrDirtySchema after a failed migration. A schema newer than this binary,
+// e.g. while rolling back a deployment, is accepted.
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return fmt.Errorf("%w at version %d", ErrDirtySchema, status.Current)
+	}
+	if len(status.Pending) > 0 {
+		return fmt.Errorf("%w: version %d, %d migration(s) pending up to %d",
+			ErrOutdatedSchema, status.Current, len(status.Pending), status.Latest)
+	}
+	return nil
+}
+
+// Up applies all pending migrations, each in its own transaction, and returns
+// the applied ones
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	for {
+		migration, err := m.step(ctx, func(current uint64) (*Migration, string, uint64) {
+			for i := range m.migrations {
+				if next := &m.migrations[i]; next.Version > current {
+					return next, next.Up, next.Version
+				}
+			}
+			return nil, "", 0
+		})
+		if err != nil {
+			return applied, err
+		}
+		if migration == nil {
+			return applied, nil
+		}
+		applied = append(applied, *migration)
+	}
+}
+
+// Down reverts the given number of migrations, newest first, and returns the
+// reverted ones
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	for len(reverted) < steps {
+		migration, err := m.step(ctx, func(current uint64) (*Migration, string, uint64) {
+			for i := len(m.migrations) - 1; i >= 0; i-- {
+				if m.migrations[i].Version != current {
+					continue
+				}
+				var previous uint64
+				if i > 0 {
+					previous = m.migrations[i-1].Version
+				}
+				return &m.migrations[i], m.migrations[i].Down, previous
+			}
+			return nil, "", 0
+		})
+		if err != nil {
+			return reverted, err
+		}
+		if migration == nil {
+			return reverted, nil
+		}
+		reverted = append(reverted, *migration)
+	}
+	return reverted, nil
+}
+
+// step runs the migration chosen by next for the current version in a
+// transaction holding the migration lock, and records the new version. It
+// returns nil when there is nothing to do.
+func (m *Migrator) step(ctx context.Context, next func(current uint64) (*Migration, string, uint64)) (*Migration, error) {
+	db := m.db.WithContext(ctx)
+	if err := ensureVersionTable(db); err != nil {
+		return nil, err
+	}
+
+	var migration *Migration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+			return err
+		}
+		// Migrations may run longer than DB_STATEMENT_TIMEOUT allows queries of requests
+		if err := tx.Exec("SET LOCAL statement_timeout = 0").Error; err != nil {
+			return err
+		}
+
+		current, dirty, err := readVersion(tx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w at version %d; repair the schema by hand, then run UPDATE schema_migrations SET dirty = false", ErrDirtySchema, current)
+		}
+
+		var script string
+		var version uint64
+		migration, script, version = next(current)
+		if migration == nil {
+			if current > 0 && !m.known(current) {
+				return fmt.Errorf("database version %d is not a migration of this binary", current)
+			}
+			return nil
+		}
+		if script == "" {
+			return fmt.Errorf("%w for %d_%s", ErrNoDownMigration, migration.Version, migration.Name)
+		}
+
+		if err := tx.Exec(script).Error; err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		return writeVersion(tx, version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+// known reports whether a migration with the version exists
+func (m *Migrator) known(version uint64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureVersionTable creates the golang-migrate version table if needed
+func ensureVersionTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`).Error
+}
+
+// readVersion returns the applied version; the table holds at most one row
+func readVersion(db *gorm.DB) (uint64, bool, error) {
+	var rows []struct {
+		Version int64
+		Dirty   bool
+	}
+	if err := db.Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&rows).Error; err != nil {
+		return 0, false, err
+	}
+	if len(rows) == 0 || rows[0].Version < 0 {
+		return 0, false, nil
+	}
+	return uint64(rows[0].Version), rows[0].Dirty, nil
+}
+
+// writeVersion replaces the applied version; version 0 empties the table
+func writeVersion(db *gorm.DB, version uint64) error {
+	if err := db.Exec("DELETE FROM schema_migrations").Error; err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	return db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (?, false)", int64(version)).Error
+}
+
+// Create writes the up and down files of a new migration to dir and returns
+// their paths
+func Create(dir, name string, now time.Time) (string, string, error) {
+	if !namePattern.MatchString(name) {
+		return "", "", fmt.Errorf("migration name must consist of lowercase letters, digits and underscores, e.g. add_event_location")
+	}
+
+	base := filepath.Join(dir, now.UTC().Format("20060102150405")+"_"+name)
+	up, down := base+".up.sql", base+".down.sql"
+	for path, content := range map[string]string{
+		up:   "-- " + name + "\n",
+		down: "-- Revert " + name + "\n",
+	} {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		_, err = file.WriteString(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
@@ -0,0 +1,45 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"manage/internal/config"
+	"manage/internal/logging"
+	"manage/migrations"
+
+	"gorm.io/gorm"
+)
+
+var logger = logging.For("migrate")
+
+// CheckOnStartup compares the schema with the embedded migrations before the
+// server uses the database, at startup and after reconnecting. Depending on
+// DB_SCHEMA_CHECK an outdated schema is an error, only logged, or migrated. A
+// dirty schema is an error unless set to warn.
+func CheckOnStartup(ctx context.Context, db *gorm.DB, mode string) error {
+	migrator, err := New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	err = migrator.Check(ctx)
+	switch {
+	case err == nil:
+		return nil
+	case mode == config.SchemaCheckWarn:
+		logger.WarnContext(ctx, "Schema check failed, starting anyway because DB_SCHEMA_CHECK=warn", "error", err)
+		return nil
+	case mode == config.SchemaCheckMigrate && errors.Is(err, ErrOutdatedSchema):
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			logger.InfoContext(ctx, "Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+		return err
+	case errors.Is(err, ErrOutdatedSchema):
+		return fmt.Errorf("%w; run \"./main migrate up\" or set DB_SCHEMA_CHECK=migrate", err)
+	default:
+		return err
+	}
+}
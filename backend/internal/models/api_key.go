@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so keys can be told apart from JWTs and
+// found by secret scanners
+const APIKeyPrefix = "ccl_"
+
+// APIKey authenticates scripts and integrations. The key itself is only shown
+// once; the prefix identifies it and only its SHA-256 hash is stored.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	SiteID     string     `json:"site_id" gorm:"not null"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	KeyHash    string     `json:"-" gorm:"not null"`
+	Scopes     StringList `json:"scopes" gorm:"type:jsonb;default:'[]'"`
+	CreatedBy  string     `json:"created_by" gorm:"not null"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip" gorm:"column:last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the APIKey model
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsActive reports whether the key can still be used
+func (k *APIKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// APIKeyPrincipal is the identity behind a valid API key
+type APIKeyPrincipal struct {
+	Subject string
+	Scopes  []string
+	// SiteID is the only site the key may access
+	SiteID string
+}
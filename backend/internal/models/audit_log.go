@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditLog records one request to a protected route: who did what to which
+// record, from where, and how the record changed. Entries form a hash chain,
+// each hash covering the entry and the hash of its predecessor, so edited or
+// deleted entries can be detected. The chain spans all sites; SiteID tells
+// which site a request acted on.
+type AuditLog struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// SiteID is the site of the request, "*" for cross-site views, or empty
+	// for entries recorded before sites existed, which belong to the default site
+	SiteID     string    `json:"site_id" gorm:"not null;default:''"`
+	Actor      string    `json:"actor" gorm:"not null"`
+	Action     string    `json:"action" gorm:"not null"`
+	TargetType string    `json:"target_type" gorm:"not null"`
+	TargetID   *string   `json:"target_id"`
+	Status     int       `json:"status" gorm:"not null"`
+	IPAddress  *string   `json:"ip_address" gorm:"column:ip_address"`
+	Before     JSONB     `json:"before" gorm:"type:jsonb"`
+	After      JSONB     `json:"after" gorm:"type:jsonb"`
+	Changes    JSONB     `json:"changes" gorm:"type:jsonb"`
+	Details    JSONB     `json:"details" gorm:"type:jsonb"`
+	PrevHash   string    `json:"prev_hash" gorm:"not null"`
+	Hash       string    `json:"hash" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for the AuditLog model
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
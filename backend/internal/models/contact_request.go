@@ -9,6 +9,7 @@ import (
 // ContactRequest represents a contact form submission
 type ContactRequest struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
+	SiteID    string         `json:"site_id" gorm:"not null"`
 	Name      string         `json:"name" gorm:"not null"`
 	Email     string         `json:"email" gorm:"not null"`
 	Phone     *string        `json:"phone" gorm:"type:varchar(20)"`
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// Event statuses, mirroring the schema.org EventStatusType values
+const (
+	EventStatusScheduled   = "scheduled"
+	EventStatusCancelled   = "cancelled"
+	EventStatusPostponed   = "postponed"
+	EventStatusRescheduled = "rescheduled"
+	EventStatusMovedOnline = "moved_online"
+)
+
+// Event represents a church event shown on the public events page
+type Event struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	SiteID        string     `json:"site_id" gorm:"not null"`
+	Title         string     `json:"title" gorm:"not null"`
+	Description   string     `json:"description" gorm:"type:text;not null;default:''"`
+	StartTime     time.Time  `json:"start_time" gorm:"not null"`
+	EndTime       *time.Time `json:"end_time"`
+	LocationName  string     `json:"location_name" gorm:"not null"`
+	StreetAddress *string    `json:"street_address"`
+	City          *string    `json:"city"`
+	PostalCode    *string    `json:"postal_code"`
+	Country       *string    `json:"country"`
+	ImageURL      *string    `json:"image_url" gorm:"column:image_url"`
+	Status        string     `json:"status" gorm:"not null;default:'scheduled'"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the Event model
+func (Event) TableName() string {
+	return "events"
+}
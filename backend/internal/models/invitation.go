@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// Invitation statuses, derived from the timestamps of an invitation
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusRevoked  = "revoked"
+	InvitationStatusExpired  = "expired"
+)
+
+// Invitation invites a person by email to become an admin with the given roles
+// and sites. Only the SHA-256 hash of the invitation token is stored.
+type Invitation struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Email      string     `json:"email" gorm:"not null"`
+	Roles      StringList `json:"roles" gorm:"type:jsonb;default:'[]'"`
+	Sites      StringList `json:"sites" gorm:"type:jsonb;default:'[]'"`
+	TokenHash  string     `json:"-" gorm:"not null"`
+	InvitedBy  string     `json:"invited_by" gorm:"not null"`
+	UserID     *string    `json:"user_id"`
+	SendCount  int        `json:"send_count" gorm:"not null;default:0"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the Invitation model
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+// Status returns whether the invitation is pending, accepted, revoked or expired
+func (i *Invitation) Status() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationStatusAccepted
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case !time.Now().Before(i.ExpiresAt):
+		return InvitationStatusExpired
+	default:
+		return InvitationStatusPending
+	}
+}
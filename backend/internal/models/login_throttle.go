@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// Login throttle kinds
+const (
+	ThrottleKindAccount = "account"
+	ThrottleKindIP      = "ip"
+)
+
+// LoginThrottle tracks failed login attempts for one account or client IP
+type LoginThrottle struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Kind          string     `json:"kind" gorm:"not null"`
+	Identifier    string     `json:"identifier" gorm:"not null"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt *time.Time `json:"last_failure_at"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the LoginThrottle model
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+// IsLocked reports whether the throttle currently blocks all attempts
+func (lt *LoginThrottle) IsLocked() bool {
+	return lt.LockedUntil != nil && time.Now().Before(*lt.LockedUntil)
+}
+
+// Security event types
+const (
+	SecurityEventAccountLocked = "account_locked"
+	SecurityEventIPLocked      = "ip_locked"
+	SecurityEventLockoutClear  = "lockout_cleared"
+	SecurityEventMFAEnabled    = "mfa_enabled"
+	SecurityEventMFADisabled   = "mfa_disabled"
+	SecurityEventMFARecovery   = "mfa_recovery_code_used"
+	SecurityEventMFAPolicy     = "mfa_policy_changed"
+	SecurityEventInviteCreate  = "invitation_created"
+	SecurityEventInviteResend  = "invitation_resent"
+	SecurityEventInviteRevoke  = "invitation_revoked"
+	SecurityEventInviteAccept  = "invitation_accepted"
+	SecurityEventAPIKeyCreate  = "api_key_created"
+	SecurityEventAPIKeyRevoke  = "api_key_revoked"
+)
+
+// SecurityEvent is an entry in the security audit trail
+type SecurityEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Type      string    `json:"type" gorm:"not null"`
+	Subject   string    `json:"subject" gorm:"not null"`
+	Actor     *string   `json:"actor"`
+	IPAddress *string   `json:"ip_address" gorm:"column:ip_address"`
+	Details   JSONB     `json:"details" gorm:"type:jsonb;default:'{}'"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for the SecurityEvent model
+func (SecurityEvent) TableName() string {
+	return "security_events"
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// MagicLink is a single-use login link sent by email. Only the SHA-256 hash of
+// the link's token ID is stored.
+type MagicLink struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    string     `json:"user_id" gorm:"not null"`
+	Email     string     `json:"email" gorm:"not null"`
+	TokenHash string     `json:"-" gorm:"not null"`
+	IPAddress *string    `json:"ip_address" gorm:"column:ip_address"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the MagicLink model
+func (MagicLink) TableName() string {
+	return "magic_links"
+}
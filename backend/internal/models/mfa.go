@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// MFACredential holds the TOTP secret of a user. The secret is encrypted at
+// rest and only usable once the enrollment has been confirmed with a code.
+type MFACredential struct {
+	UserID          string     `json:"user_id" gorm:"primaryKey"`
+	SecretEncrypted string     `json:"-" gorm:"column:secret_encrypted;not null"`
+	ConfirmedAt     *time.Time `json:"confirmed_at"`
+	// LastUsedStep is the TOTP time step of the last accepted code, so codes cannot be replayed
+	LastUsedStep int64     `json:"-" gorm:"not null;default:0"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for the MFACredential model
+func (MFACredential) TableName() string {
+	return "mfa_credentials"
+}
+
+// IsConfirmed reports whether the credential is required at login
+func (mc *MFACredential) IsConfirmed() bool {
+	return mc.ConfirmedAt != nil
+}
+
+// MFARecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only the SHA-256 hash of the code is stored.
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    string     `json:"user_id" gorm:"not null"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the MFARecoveryCode model
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MFAEnforcedRole marks a role whose members must use two-factor authentication
+type MFAEnforcedRole struct {
+	Role      string    `json:"role" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for the MFAEnforcedRole model
+func (MFAEnforcedRole) TableName() string {
+	return "mfa_enforced_roles"
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents a login session, kept alive by rotating refresh tokens
+type Session struct {
+	ID            string     `json:"id" gorm:"primaryKey"`
+	UserID        string     `json:"user_id" gorm:"not null"`
+	Email         string     `json:"email" gorm:"not null"`
+	IPAddress     *string    `json:"ip_address" gorm:"column:ip_address"`
+	UserAgent     *string    `json:"user_agent" gorm:"column:user_agent"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	RevokedReason *string    `json:"revoked_reason"`
+}
+
+// TableName specifies the table name for the Session model
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsActive reports whether the session can still be used
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RefreshToken represents a single-use refresh token of a session. Only the
+// SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	SessionID string     `json:"session_id" gorm:"not null"`
+	TokenHash string     `json:"-" gorm:"not null"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the RefreshToken model
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
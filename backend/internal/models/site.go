@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Site is a congregation sharing this deployment. Contact requests, events and
+// API keys belong to exactly one site.
+type Site struct {
+	ID   string `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"not null"`
+	// Hosts are the host names whose requests are served for this site
+	Hosts StringList `json:"hosts" gorm:"type:jsonb;default:'[]'"`
+	// URL is the public website of the site, linked from its events
+	URL       string    `json:"url" gorm:"not null;default:''"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for the Site model
+func (Site) TableName() string {
+	return "sites"
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// User represents an admin account managed by the local identity provider
+type User struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Email        string     `json:"email" gorm:"not null"`
+	PasswordHash string     `json:"-" gorm:"column:password_hash;not null"`
+	Roles        StringList `json:"roles" gorm:"type:jsonb;default:'[]'"`
+	Sites        StringList `json:"sites" gorm:"type:jsonb;default:'[]'"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the User model
+func (User) TableName() string {
+	return "users"
+}
+
+// StringList is a custom type for PostgreSQL JSONB string arrays
+type StringList []string
+
+// Value implements the driver.Valuer interface
+func (s StringList) Value() (driver.Value, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s)
+}
+
+// Scan implements the sql.Scanner interface
+func (s *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*s = StringList{}
+		return nil
+	}
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("unsupported type %T for StringList", value)
+	}
+	return json.Unmarshal(bytes, s)
+}
@@ -0,0 +1,149 @@
+// Package permissions defines the named permissions of the admin panel and the
+// roles that group them.
+package permissions
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"manage/internal/config"
+)
+
+// Named permissions checked by RequirePermission
+const (
+	ContactRead   = "contact:read"
+	ContactManage = "contact:manage"
+	EventsWrite   = "events:write"
+	UsersAdmin    = "users:admin"
+	AuditRead     = "audit:read"
+	// SitesAdmin manages sites and grants access to every site, including
+	// cross-site views. Only the super_admin role carries it.
+	SitesAdmin = "sites:admin"
+)
+
+// All lists every known permission
+var All = []string{ContactRead, ContactManage, EventsWrite, UsersAdmin, AuditRead, SitesAdmin}
+
+// APIKeyScopes lists the permissions that may be granted to API keys. Managing
+// users stays reserved for people.
+var APIKeyScopes = []string{ContactRead, ContactManage, EventsWrite}
+
+// Built-in roles
+const (
+	RoleSuperAdmin       = "super_admin"
+	RoleAdmin            = "admin"
+	RoleSiteAdmin        = "site_admin"
+	RolePastoralCare     = "pastoral_care"
+	RoleEventCoordinator = "event_coordinator"
+	RoleDataProtection   = "data_protection_officer"
+)
+
+// defaultRoles maps each built-in role to its permissions. The admin role
+// manages the sites its members belong to; access to every site has to be
+// granted explicitly with super_admin.
+var defaultRoles = map[string][]string{
+	RoleSuperAdmin:       All,
+	RoleAdmin:            {ContactRead, ContactManage, EventsWrite, UsersAdmin, AuditRead},
+	RoleSiteAdmin:        {ContactRead, ContactManage, EventsWrite},
+	RolePastoralCare:     {ContactRead, ContactManage},
+	RoleEventCoordinator: {EventsWrite},
+	RoleDataProtection:   {AuditRead},
+}
+
+// Roles maps role names to the permissions they grant
+type Roles map[string][]string
+
+// LoadRoles returns the built-in roles, extended or overridden by the JSON
+// object in ROLE_PERMISSIONS, e.g. {"youth_leader":["events:write"]}
+func LoadRoles() (Roles, error) {
+	roles := Roles{}
+	for name, perms := range defaultRoles {
+		roles[name] = perms
+	}
+
+	if raw := config.Get().Auth.RolePermissions; raw != "" {
+		var overrides map[string][]string
+		if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+			return nil, fmt.Errorf("invalid ROLE_PERMISSIONS: %w", err)
+		}
+		for name, perms := range overrides {
+			for _, perm := range perms {
+				if !IsKnown(perm) {
+					return nil, fmt.Errorf("invalid ROLE_PERMISSIONS: unknown permission %q for role %q", perm, name)
+				}
+			}
+			roles[name] = perms
+		}
+	}
+
+	return roles, nil
+}
+
+var (
+	loadOnce    sync.Once
+	loadedRoles Roles
+)
+
+// Default returns the roles from LoadRoles, loaded once. It falls back to the
+// built-in roles when ROLE_PERMISSIONS is invalid; startup validates the
+// variable separately so that never goes unnoticed.
+func Default() Roles {
+	loadOnce.Do(func() {
+		roles, err := LoadRoles()
+		if err != nil {
+			roles = Roles(defaultRoles)
+		}
+		loadedRoles = roles
+	})
+	return loadedRoles
+}
+
+// Resolve returns the sorted permissions granted by the given roles. Users
+// without any role who are members of siteID get the site_admin role, which
+// matches the access site members had before roles existed.
+func (r Roles) Resolve(roles, sites []string, siteID string) []string {
+	if len(roles) == 0 && siteID != "" && contains(sites, siteID) {
+		roles = []string{RoleSiteAdmin}
+	}
+
+	set := map[string]bool{}
+	for _, role := range roles {
+		for _, perm := range r[role] {
+			set[perm] = true
+		}
+	}
+
+	perms := make([]string, 0, len(set))
+	for perm := range set {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// IsKnown reports whether perm is a defined permission
+func IsKnown(perm string) bool {
+	return contains(All, perm)
+}
+
+// HasAll reports whether granted contains every required permission
+func HasAll(granted []string, required ...string) bool {
+	for _, perm := range required {
+		if !contains(granted, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether list contains value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
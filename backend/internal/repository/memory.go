@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"manage/internal/models"
+	"manage/internal/tenancy"
+)
+
+// MemoryContactRequestRepository keeps contact requests in memory, scoped by
+// site like the Postgres repository
+type MemoryContactRequestRepository struct {
+	mu       sync.Mutex
+	requests map[uint]models.ContactRequest
+	nextID   uint
+}
+
+// NewMemoryContactRequestRepository creates an empty repository
+func NewMemoryContactRequestRepository() *MemoryContactRequestRepository {
+	return &MemoryContactRequestRepository{requests: map[uint]models.ContactRequest{}, nextID: 1}
+}
+
+// Create stores a new contact request for the site in the context
+func (r *MemoryContactRequestRepository) Create(ctx context.Context, request *models.ContactRequest) error {
+	siteID, ok := tenancy.SiteFromContext(ctx)
+	if !ok || siteID == tenancy.AllSites {
+		return tenancy.ErrNoSite
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	request.ID = r.nextID
+	request.SiteID = siteID
+	if request.CreatedAt.IsZero() {
+		request.CreatedAt = time.Now()
+	}
+	r.nextID++
+	r.requests[request.ID] = cloneContactRequest(*request)
+	return nil
+}
+
+// List returns the contact requests of the site, newest first
+func (r *MemoryContactRequestRepository) List(ctx context.Context) ([]models.ContactRequest, error) {
+	siteID, ok := tenancy.SiteFromContext(ctx)
+	if !ok {
+		return nil, tenancy.ErrNoSite
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := []models.ContactRequest{}
+	for _, request := range r.requests {
+		if visible(request.SiteID, siteID) {
+			requests = append(requests, cloneContactRequest(request))
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].CreatedAt.Equal(requests[j].CreatedAt) {
+			return requests[i].CreatedAt.After(requests[j].CreatedAt)
+		}
+		return requests[i].ID > requests[j].ID
+	})
+	return requests, nil
+}
+
+// Get returns a contact request of the site by ID
+func (r *MemoryContactRequestRepository) Get(ctx context.Context, id uint) (*models.ContactRequest, error) {
+	siteID, ok := tenancy.SiteFromContext(ctx)
+	if !ok {
+		return nil, tenancy.ErrNoSite
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	request, found := r.requests[id]
+	if !found || !visible(request.SiteID, siteID) {
+		return nil, ErrNotFound
+	}
+	request = cloneContactRequest(request)
+	return &request, nil
+}
+
+// Delete removes a contact request of the site
+func (r *MemoryContactRequestRepository) Delete(ctx context.Context, id uint) error {
+	siteID, ok := tenancy.SiteFromContext(ctx)
+	if !ok {
+		return tenancy.ErrNoSite
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	request, found := r.requests[id]
+	if !found || !visible(request.SiteID, siteID) {
+		return ErrNotFound
+	}
+	delete(r.requests, id)
+	return nil
+}
+
+// MemoryUserRepository keeps users in memory
+type MemoryUserRepository struct {
+	mu     sync.Mutex
+	users  map[uint]models.User
+	nextID uint
+}
+
+// NewMemoryUserRepository creates an empty repository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[uint]models.User{}, nextID: 1}
+}
+
+// Create stores a new user unless the email address is taken
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.findByEmail(user.Email); found {
+		return ErrDuplicate
+	}
+
+	now := time.Now()
+	user.ID = r.nextID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+	r.nextID++
+	r.users[user.ID] = cloneUser(*user)
+	return nil
+}
+
+// FindByEmail returns the user with the email address, ignoring case
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, found := r.findByEmail(email)
+	if !found {
+		return nil, ErrNotFound
+	}
+	user = cloneUser(user)
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) findByEmail(email string) (models.User, bool) {
+	email = strings.TrimSpace(email)
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
+
+// FindByID returns a user by ID
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, found := r.users[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	user = cloneUser(user)
+	return &user, nil
+}
+
+// RecordLogin sets the time of the user's last login
+func (r *MemoryUserRepository) RecordLogin(ctx context.Context, id uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, found := r.users[id]
+	if !found {
+		return ErrNotFound
+	}
+	user.LastLoginAt = &at
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return nil
+}
+
+// visible reports whether a row of rowSite is in the scope of siteID
+func visible(rowSite, siteID string) bool {
+	return siteID == tenancy.AllSites || rowSite == siteID
+}
+
+// cloneContactRequest copies a request so callers cannot modify the stored one
+func cloneContactRequest(request models.ContactRequest) models.ContactRequest {
+	request.Phone = clonePointer(request.Phone)
+	request.IPAddress = clonePointer(request.IPAddress)
+	request.UserAgent = clonePointer(request.UserAgent)
+	metadata := models.JSONB{}
+	for key, value := range request.Metadata {
+		metadata[key] = value
+	}
+	request.Metadata = metadata
+	return request
+}
+
+// cloneUser copies a user so callers cannot modify the stored one; like the
+// JSONB columns, missing roles and sites read as empty lists
+func cloneUser(user models.User) models.User {
+	user.Roles = append(models.StringList{}, user.Roles...)
+	user.Sites = append(models.StringList{}, user.Sites...)
+	user.LastLoginAt = clonePointer(user.LastLoginAt)
+	return user
+}
+
+func clonePointer[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
@@ -0,0 +1,20 @@
+package repository_test
+
+import (
+	"testing"
+
+	"manage/internal/repository"
+	"manage/internal/repository/repositorytest"
+)
+
+func TestMemoryContactRequestRepository(t *testing.T) {
+	repositorytest.ContactRequests(t, func(t *testing.T) repository.ContactRequestRepository {
+		return repository.NewMemoryContactRequestRepository()
+	})
+}
+
+func TestMemoryUserRepository(t *testing.T) {
+	repositorytest.Users(t, func(t *testing.T) repository.UserRepository {
+		return repository.NewMemoryUserRepository()
+	})
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PostgresContactRequestRepository stores contact requests with GORM. The
+// tenant callbacks registered on the connection limit it to the site in the
+// context.
+type PostgresContactRequestRepository struct {
+	db func() *gorm.DB
+}
+
+// NewPostgresContactRequestRepository creates a repository on the handle
+// returned by db, usually config.GetDB, which is nil while the database is
+// unavailable
+func NewPostgresContactRequestRepository(db func() *gorm.DB) *PostgresContactRequestRepository {
+	return &PostgresContactRequestRepository{db: db}
+}
+
+// Create stores a new contact request
+func (r *PostgresContactRequestRepository) Create(ctx context.Context, request *models.ContactRequest) error {
+	db, err := withContext(r.db, ctx)
+	if err != nil {
+		return err
+	}
+	return db.Create(request).Error
+}
+
+// List returns all contact requests, newest first
+func (r *PostgresContactRequestRepository) List(ctx context.Context) ([]models.ContactRequest, error) {
+	db, err := withContext(r.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []models.ContactRequest
+	if err := db.Order("created_at DESC, id DESC").Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// Get returns a contact request by ID
+func (r *PostgresContactRequestRepository) Get(ctx context.Context, id uint) (*models.ContactRequest, error) {
+	db, err := withContext(r.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var request models.ContactRequest
+	if err := db.First(&request, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &request, nil
+}
+
+// Delete permanently removes a contact request
+func (r *PostgresContactRequestRepository) Delete(ctx context.Context, id uint) error {
+	db, err := withContext(r.db, ctx)
+	if err != nil {
+		return err
+	}
+
+	result := db.Delete(&models.ContactRequest{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PostgresUserRepository stores users with GORM
+type PostgresUserRepository struct {
+	db func() *gorm.DB
+}
+
+// NewPostgresUserRepository creates a repository on the handle returned by
+// db, usually config.GetDB
+func NewPostgresUserRepository(db func() *gorm.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db}
+}
+
+// Create stores a new user unless the email address is taken
+func (r *PostgresUserRepository) Create(ctx context.Context, user *models.User) error {
+	db, err := withContext(r.db, ctx)
+	if err != nil {
+		return err
+	}
+
+	// The unique index on LOWER(email) still guards against concurrent inserts
+	if _, err := r.findByEmail(db, user.Email); err == nil {
+		return ErrDuplicate
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return db.Create(user).Error
+}
+
+// FindByEmail returns the user with the email address, ignoring case
+func (r *PostgresUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	db, err := withContext(r.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.findByEmail(db, email)
+}
+
+func (r *PostgresUserRepository) findByEmail(db *gorm.DB, email string) (*models.User, error) {
+	var user models.User
+	if err := db.Where("LOWER(email) = LOWER(?)", strings.TrimSpace(email)).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+// FindByID returns a user by ID
+func (r *PostgresUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	db, err := withContext(r.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+// RecordLogin sets the time of the user's last login
+func (r *PostgresUserRepository) RecordLogin(ctx context.Context, id uint, at time.Time) error {
+	db, err := withContext(r.db, ctx)
+	if err != nil {
+		return err
+	}
+
+	result := db.Model(&models.User{}).Where("id = ?", id).Update("last_login_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// withContext returns the database handle bound to the context
+func withContext(db func() *gorm.DB, ctx context.Context) (*gorm.DB, error) {
+	handle := db()
+	if handle == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return handle.WithContext(ctx), nil
+}
+
+// notFound translates GORM's missing record error
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+// Package repository hides how contact requests and users are stored, so
+// controllers and services can run against Postgres or, e.g. in tests, memory.
+// Contact requests are tenant data: every method works on the site in the
+// context (tenancy.WithSite) and fails with tenancy.ErrNoSite without one.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"manage/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when no record matches, including records of
+	// other sites
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a record with the same unique key exists
+	ErrDuplicate = errors.New("record already exists")
+)
+
+// ContactRequestRepository stores contact form submissions
+type ContactRequestRepository interface {
+	// Create stores a new request for the site in the context and sets its
+	// ID, SiteID and, unless given, CreatedAt
+	Create(ctx context.Context, request *models.ContactRequest) error
+	// List returns all requests, newest first
+	List(ctx context.Context) ([]models.ContactRequest, error)
+	Get(ctx context.Context, id uint) (*models.ContactRequest, error)
+	Delete(ctx context.Context, id uint) error
+}
+
+// UserRepository stores the accounts of the local identity provider. Email
+// addresses are unique and compared case-insensitively.
+type UserRepository interface {
+	// Create stores a new user and sets its ID and timestamps. It returns
+	// ErrDuplicate when the email address is taken.
+	Create(ctx context.Context, user *models.User) error
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	// RecordLogin sets the time of the user's last login
+	RecordLogin(ctx context.Context, id uint, at time.Time) error
+}
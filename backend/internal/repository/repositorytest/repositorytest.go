@@ -0,0 +1,243 @@
+// Package repositorytest holds the contract every repository implementation
+// must fulfil. Tests of an implementation call ContactRequests and Users with
+// a constructor for empty repositories, so the Postgres and the in-memory
+// repositories are held to the same behavior.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"manage/internal/models"
+	"manage/internal/repository"
+	"manage/internal/tenancy"
+)
+
+// ContactRequests runs the contract of ContactRequestRepository against
+// repositories returned by newRepository, which must be empty
+func ContactRequests(t *testing.T, newRepository func(t *testing.T) repository.ContactRequestRepository) {
+	siteA := tenancy.WithSite(context.Background(), "site-a")
+	siteB := tenancy.WithSite(context.Background(), "site-b")
+	allSites := tenancy.WithAllSites(context.Background())
+	created := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Create and Get", func(t *testing.T) {
+		repo := newRepository(t)
+		phone := "+49 2941 12345"
+		request := &models.ContactRequest{
+			Name:     "Anna",
+			Email:    "anna@example.com",
+			Phone:    &phone,
+			Message:  "Hello",
+			Metadata: models.JSONB{"source": "form"},
+		}
+		if err := repo.Create(siteA, request); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if request.ID == 0 || request.SiteID != "site-a" || request.CreatedAt.IsZero() {
+			t.Fatalf("Create did not set ID, SiteID and CreatedAt: %+v", request)
+		}
+
+		got, err := repo.Get(siteA, request.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Name != "Anna" || got.Email != "anna@example.com" || got.Message != "Hello" || got.SiteID != "site-a" {
+			t.Errorf("Get returned %+v", got)
+		}
+		if got.Phone == nil || *got.Phone != phone {
+			t.Errorf("Get returned phone %v, want %q", got.Phone, phone)
+		}
+		if got.Metadata["source"] != "form" {
+			t.Errorf("Get returned metadata %v", got.Metadata)
+		}
+	})
+
+	t.Run("List returns the newest first", func(t *testing.T) {
+		repo := newRepository(t)
+		for i, name := range []string{"first", "second", "third"} {
+			request := &models.ContactRequest{Name: name, Email: "x@example.com", Message: "m",
+				CreatedAt: created.Add(time.Duration(i) * time.Hour)}
+			if err := repo.Create(siteA, request); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		requests, err := repo.List(siteA)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if names := contactRequestNames(requests); !equal(names, []string{"third", "second", "first"}) {
+			t.Errorf("List returned %v", names)
+		}
+	})
+
+	t.Run("requests are scoped to their site", func(t *testing.T) {
+		repo := newRepository(t)
+		a := &models.ContactRequest{Name: "a", Email: "a@example.com", Message: "m", CreatedAt: created}
+		b := &models.ContactRequest{Name: "b", Email: "b@example.com", Message: "m", CreatedAt: created.Add(time.Hour)}
+		if err := repo.Create(siteA, a); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := repo.Create(siteB, b); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		requests, err := repo.List(siteB)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if names := contactRequestNames(requests); !equal(names, []string{"b"}) {
+			t.Errorf("List of site-b returned %v", names)
+		}
+		if _, err := repo.Get(siteB, a.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Get of another site's request: got %v, want ErrNotFound", err)
+		}
+		if err := repo.Delete(siteB, a.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Delete of another site's request: got %v, want ErrNotFound", err)
+		}
+
+		requests, err = repo.List(allSites)
+		if err != nil {
+			t.Fatalf("List of all sites: %v", err)
+		}
+		if names := contactRequestNames(requests); !equal(names, []string{"b", "a"}) {
+			t.Errorf("List of all sites returned %v", names)
+		}
+	})
+
+	t.Run("a site is required", func(t *testing.T) {
+		repo := newRepository(t)
+		request := &models.ContactRequest{Name: "a", Email: "a@example.com", Message: "m"}
+		if err := repo.Create(context.Background(), request); !errors.Is(err, tenancy.ErrNoSite) {
+			t.Errorf("Create without a site: got %v, want ErrNoSite", err)
+		}
+		if err := repo.Create(allSites, request); !errors.Is(err, tenancy.ErrNoSite) {
+			t.Errorf("Create for all sites: got %v, want ErrNoSite", err)
+		}
+		if _, err := repo.List(context.Background()); !errors.Is(err, tenancy.ErrNoSite) {
+			t.Errorf("List without a site: got %v, want ErrNoSite", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepository(t)
+		request := &models.ContactRequest{Name: "a", Email: "a@example.com", Message: "m"}
+		if err := repo.Create(siteA, request); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := repo.Delete(siteA, request.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := repo.Get(siteA, request.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+		}
+		if err := repo.Delete(siteA, request.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("second Delete: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// Users runs the contract of UserRepository against repositories returned by
+// newRepository, which must be empty
+func Users(t *testing.T, newRepository func(t *testing.T) repository.UserRepository) {
+	ctx := context.Background()
+
+	t.Run("Create and find", func(t *testing.T) {
+		repo := newRepository(t)
+		user := &models.User{
+			Email:        "Admin@Example.com",
+			PasswordHash: "hash",
+			Roles:        models.StringList{"admin"},
+			Sites:        models.StringList{"site-a"},
+		}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if user.ID == 0 || user.CreatedAt.IsZero() {
+			t.Fatalf("Create did not set ID and CreatedAt: %+v", user)
+		}
+
+		byEmail, err := repo.FindByEmail(ctx, " admin@example.COM ")
+		if err != nil {
+			t.Fatalf("FindByEmail: %v", err)
+		}
+		if byEmail.ID != user.ID || byEmail.Email != "Admin@Example.com" || byEmail.PasswordHash != "hash" {
+			t.Errorf("FindByEmail returned %+v", byEmail)
+		}
+
+		byID, err := repo.FindByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if !equal(byID.Roles, []string{"admin"}) || !equal(byID.Sites, []string{"site-a"}) || byID.LastLoginAt != nil {
+			t.Errorf("FindByID returned %+v", byID)
+		}
+	})
+
+	t.Run("email addresses are unique ignoring case", func(t *testing.T) {
+		repo := newRepository(t)
+		if err := repo.Create(ctx, &models.User{Email: "admin@example.com", PasswordHash: "hash"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		err := repo.Create(ctx, &models.User{Email: "ADMIN@example.com", PasswordHash: "hash"})
+		if !errors.Is(err, repository.ErrDuplicate) {
+			t.Errorf("Create with a taken email: got %v, want ErrDuplicate", err)
+		}
+	})
+
+	t.Run("unknown users", func(t *testing.T) {
+		repo := newRepository(t)
+		if _, err := repo.FindByEmail(ctx, "nobody@example.com"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("FindByEmail: got %v, want ErrNotFound", err)
+		}
+		if _, err := repo.FindByID(ctx, 4711); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("FindByID: got %v, want ErrNotFound", err)
+		}
+		if err := repo.RecordLogin(ctx, 4711, time.Now()); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("RecordLogin: got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("RecordLogin", func(t *testing.T) {
+		repo := newRepository(t)
+		user := &models.User{Email: "admin@example.com", PasswordHash: "hash"}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+		if err := repo.RecordLogin(ctx, user.ID, at); err != nil {
+			t.Fatalf("RecordLogin: %v", err)
+		}
+
+		got, err := repo.FindByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if got.LastLoginAt == nil || !got.LastLoginAt.Equal(at) {
+			t.Errorf("LastLoginAt is %v, want %v", got.LastLoginAt, at)
+		}
+	})
+}
+
+func contactRequestNames(requests []models.ContactRequest) []string {
+	names := make([]string, 0, len(requests))
+	for _, request := range requests {
+		names = append(names, request.Name)
+	}
+	return names
+}
+
+func equal[T ~[]string](a T, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,45 +1,215 @@
 package routes
 
 import (
+	"net/http"
+
+	"manage/internal/config"
 	"manage/internal/controllers"
+	"manage/internal/health"
+	"manage/internal/metrics"
 	"manage/internal/middleware"
+	"manage/internal/permissions"
+	"manage/internal/repository"
+	"manage/internal/server"
+	"manage/internal/services"
+	"manage/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes configures all API routes
 func SetupRoutes(r *gin.Engine) {
+	// Initialize repositories; they answer with config.ErrDatabaseUnavailable
+	// while the database is down
+	contactRequests := repository.NewPostgresContactRequestRepository(config.GetDB)
+	users := repository.NewPostgresUserRepository(config.GetDB)
+
+	// Initialize shared services
+	sessionService := services.NewSessionService()
+	securityEventService := services.NewSecurityEventService()
+	loginThrottleService := services.NewLoginThrottleService(securityEventService)
+	apiKeyService := services.NewAPIKeyService(securityEventService)
+	auditService := services.NewAuditService()
+	siteService := services.NewSiteService()
+	mfaService := services.NewMFAService(securityEventService)
+	emailService := services.NewEmailService()
+	magicLinkService := services.NewMagicLinkService(middleware.JWTSecret(), emailService)
+	invitationService := services.NewInvitationService(emailService, securityEventService)
+
 	// Initialize controllers
-	healthController := controllers.NewHealthController()
-	authController := controllers.NewAuthController()
-	contactRequestController := controllers.NewContactRequestController()
+	healthController := controllers.NewHealthController(server.Ready, newHealthChecks(config.Get()))
+	authController := controllers.NewAuthController(users, sessionService, loginThrottleService, mfaService, magicLinkService)
+	sessionController := controllers.NewSessionController(sessionService)
+	mfaController := controllers.NewMFAController(mfaService)
+	invitationController := controllers.NewInvitationController(users, invitationService, permissions.Default())
+	apiKeyController := controllers.NewAPIKeyController(apiKeyService)
+	auditController := controllers.NewAuditController(auditService)
+	siteController := controllers.NewSiteController(siteService)
+	securityController := controllers.NewSecurityController(loginThrottleService, securityEventService)
+	contactRequestController := controllers.NewContactRequestController(contactRequests)
+	eventController := controllers.NewEventController(siteService)
+	docsController := controllers.NewDocsController()
 
 	// Public API routes
 	api := r.Group("/api")
 	{
 		// Health check
 		api.GET("/health", healthController.HealthCheck)
+		api.GET("/health/live", healthController.Liveness)
+		api.GET("/health/ready", healthController.Readiness)
+		if token := config.Get().Health.Token; token != "" {
+			api.GET("/health/details", middleware.RequireBearerToken(token), healthController.Details)
+		}
+
+		// API documentation; every route must be described in
+		// internal/apidocs/openapi.yaml, "./main openapi check" tells
+		api.GET("/openapi.json", docsController.OpenAPI)
+		api.GET("/docs", docsController.Docs)
+
+		// Routes registered below need the database and answer 503 while it is
+		// unavailable
+		api.Use(middleware.RequireDatabase(config.DatabaseAvailable))
+
+		// Routes registered below are served for the site of the request,
+		// resolved from the Host header
+		api.Use(middleware.Tenant(siteService))
 
 		// Auth routes (public)
 		api.POST("/auth/login", authController.Login)
 		api.GET("/auth/logout", authController.Logout)
+		api.POST("/auth/refresh", authController.Refresh)
+		api.POST("/auth/mfa", authController.CompleteMFA)
+		api.POST("/auth/magic-link", authController.RequestMagicLink)
+		api.POST("/auth/magic-link/verify", authController.VerifyMagicLink)
+
+		// Invitations are redeemed by people who have no account yet
+		api.POST("/invitations/preview", invitationController.PreviewInvitation)
+		api.POST("/invitations/accept", invitationController.AcceptInvitation)
+		api.POST("/auth/mfa/setup", mfaController.BeginPendingEnrollment)
 
 		// Contact requests (public)
 		api.POST("/contact-requests", contactRequestController.CreateContactRequest)
+
+		// Events and their search engine metadata (public)
+		api.GET("/events", eventController.GetEvents)
+		api.GET("/events/structured-data", eventController.GetEventsStructuredData)
+		api.GET("/events/:id", eventController.GetEvent)
+		api.GET("/events/:id/structured-data", eventController.GetEventStructuredData)
 	}
 
-	// Protected API routes (require authentication)
+	// Protected API routes (require authentication with a JWT or an API key).
+	// Every request to them is recorded in the audit log, and callers only
+	// see the sites they belong to. Routes returning personal data are marked
+	// with PersonalData, so they fail rather than answer without an entry.
 	protected := api.Group("")
-	protected.Use(middleware.Auth0Middleware())
+	protected.Use(
+		middleware.Auth0Middleware(sessionService, apiKeyService),
+		middleware.Audit(auditService),
+		middleware.RequireSiteAccess(siteService),
+	)
 	{
+		// Routes acting on the account of a person are closed to API keys
+		account := protected.Group("")
+		account.Use(middleware.RequireUser())
+
 		// Profile endpoint
-		protected.GET("/profile", authController.Profile)
+		account.GET("/profile", authController.Profile)
+
+		// Sessions of the current user
+		account.POST("/auth/logout", authController.EndSession)
+		account.GET("/auth/sessions", sessionController.GetSessions)
+		account.DELETE("/auth/sessions", sessionController.RevokeAllSessions)
+		account.DELETE("/auth/sessions/:id", sessionController.RevokeSession)
+
+		// Two-factor authentication of the current user
+		account.GET("/auth/mfa", mfaController.GetStatus)
+		account.DELETE("/auth/mfa", mfaController.Disable)
+		account.POST("/auth/mfa/enroll", mfaController.BeginEnrollment)
+		account.POST("/auth/mfa/enroll/confirm", mfaController.ConfirmEnrollment)
+		account.POST("/auth/mfa/recovery-codes", mfaController.RegenerateRecoveryCodes)
+
+		// API keys for scripts and integrations
+		account.GET("/api-keys", middleware.RequirePermission(permissions.UsersAdmin), apiKeyController.GetAPIKeys)
+		account.POST("/api-keys", middleware.RequirePermission(permissions.UsersAdmin), apiKeyController.CreateAPIKey)
+		account.DELETE("/api-keys/:id", middleware.RequirePermission(permissions.UsersAdmin), apiKeyController.RevokeAPIKey)
 
 		// Contact requests (protected)
-		protected.GET("/contact-requests", contactRequestController.GetContactRequests)
-		protected.GET("/contact-requests/:id", contactRequestController.GetContactRequest)
+		protected.GET("/contact-requests", middleware.RequirePermission(permissions.ContactRead), middleware.PersonalData(), contactRequestController.GetContactRequests)
+		protected.GET("/contact-requests/:id", middleware.RequirePermission(permissions.ContactRead), middleware.PersonalData(), contactRequestController.GetContactRequest)
+		protected.DELETE("/contact-requests/:id", middleware.RequirePermission(permissions.ContactManage), contactRequestController.DeleteContactRequest)
+
+		// Security: login lockouts and audit trail (protected)
+		protected.GET("/security/lockouts", middleware.RequirePermission(permissions.UsersAdmin), middleware.PersonalData(), securityController.GetLockouts)
+		protected.DELETE("/security/lockouts/:id", middleware.RequirePermission(permissions.UsersAdmin), securityController.ClearLockout)
+		protected.GET("/security/events", middleware.RequirePermission(permissions.UsersAdmin), middleware.PersonalData(), securityController.GetSecurityEvents)
+		protected.GET("/security/mfa-policy", middleware.RequirePermission(permissions.UsersAdmin), mfaController.GetPolicy)
+		protected.PUT("/security/mfa-policy", middleware.RequirePermission(permissions.UsersAdmin), mfaController.UpdatePolicy)
+
+		// Audit log for the data protection officer (protected)
+		protected.GET("/audit-logs", middleware.RequirePermission(permissions.AuditRead), middleware.PersonalData(), auditController.GetAuditLogs)
+		protected.GET("/audit-logs/verify", middleware.RequirePermission(permissions.AuditRead), auditController.VerifyAuditLog)
+
+		// Sites sharing this deployment (protected)
+		protected.GET("/sites", siteController.GetSites)
+		protected.POST("/sites", middleware.RequirePermission(permissions.SitesAdmin), siteController.CreateSite)
+		protected.PUT("/sites/:id", middleware.RequirePermission(permissions.SitesAdmin), siteController.UpdateSite)
+
+		// Invitations of new admins (protected)
+		protected.GET("/invitations", middleware.RequirePermission(permissions.UsersAdmin), middleware.PersonalData(), invitationController.GetInvitations)
+		protected.POST("/invitations", middleware.RequirePermission(permissions.UsersAdmin), invitationController.CreateInvitation)
+		protected.POST("/invitations/:id/resend", middleware.RequirePermission(permissions.UsersAdmin), invitationController.ResendInvitation)
+		protected.DELETE("/invitations/:id", middleware.RequirePermission(permissions.UsersAdmin), invitationController.RevokeInvitation)
+
+		// Events (protected)
+		protected.POST("/events", middleware.RequirePermission(permissions.EventsWrite), eventController.CreateEvent)
+		protected.PUT("/events/:id", middleware.RequirePermission(permissions.EventsWrite), eventController.UpdateEvent)
+		protected.DELETE("/events/:id", middleware.RequirePermission(permissions.EventsWrite), eventController.DeleteEvent)
 	}
 
+	// Unknown routes are answered with a problem like every other error
+	r.NoRoute(middleware.NotFound())
+
 	// Future API versions can be added here
 	// v2 := r.Group("/api/v2")
 }
+
+// emailQueueLimit is the number of queued emails from which the email queue
+// check reports degraded. Emails are not persisted in an outbox; they wait in
+// memory for a background sender, so the check only sees this process and
+// starts from zero after a restart.
+const emailQueueLimit = 50
+
+// newHealthChecks registers the checks of the dependencies; only the database
+// is critical, the others show up in /api/health/details
+func newHealthChecks(cfg *config.Config) *health.Registry {
+	checks := health.NewRegistry(cfg.Health.Timeout, cfg.Health.CacheTTL)
+	checks.Register(health.Check{Name: "database", Critical: true, Check: health.Database(config.SQLDB, config.DatabaseAvailable)})
+	checks.Register(health.Check{Name: "migrations", Check: health.Migrations(config.GetDB)})
+	checks.Register(health.Check{Name: "email_queue", Check: health.Queue(metrics.EmailQueueDepth, emailQueueLimit)})
+	if cfg.SMTP.Host != "" {
+		checks.Register(health.Check{Name: "smtp", Check: health.SMTP(cfg.SMTP.Host, cfg.SMTP.Port)})
+	}
+	if cfg.Auth.IdentityProvider == "auth0" {
+		client := &http.Client{Transport: tracing.Transport(nil)}
+		checks.Register(health.Check{Name: "auth0", Check: health.HTTP(client, cfg.Auth0.BaseURL()+"/.well-known/openid-configuration")})
+	}
+	return checks
+}
+
+// SetupMetrics serves /metrics for Prometheus. With METRICS_ADDR it returns
+// the handler of the internal listener, which also asks for METRICS_TOKEN if
+// one is set; otherwise /metrics is added to r behind METRICS_TOKEN and nil is
+// returned. Without either the metrics are not served.
+func SetupMetrics(r *gin.Engine, cfg config.MetricsConfig) http.Handler {
+	handler := gin.WrapH(metrics.Handler())
+	switch {
+	case cfg.Addr != "":
+		internal := gin.New()
+		internal.Use(middleware.Errors(), middleware.Recovery())
+		internal.GET("/metrics", middleware.RequireBearerToken(cfg.Token), handler)
+		return internal
+	case cfg.Token != "":
+		r.GET("/metrics", middleware.RequireBearerToken(cfg.Token), handler)
+	}
+	return nil
+}
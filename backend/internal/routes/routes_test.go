@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"testing"
+
+	"manage/internal/apidocs"
+	"manage/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRoutesAreDocumented fails when a route is missing from
+// internal/apidocs/openapi.yaml or a documented operation has no route
+func TestRoutesAreDocumented(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	// Register the routes that are only served with a token, too
+	cfg.Health.Token = "routes-test"
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	SetupRoutes(r)
+	SetupMetrics(r, config.MetricsConfig{Token: "routes-test"})
+
+	undocumented, unrouted := apidocs.Coverage(r.Routes())
+	for _, operation := range undocumented {
+		t.Errorf("route not documented: %s", operation)
+	}
+	for _, operation := range unrouted {
+		t.Errorf("documented operation has no route: %s", operation)
+	}
+}
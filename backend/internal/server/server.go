@@ -0,0 +1,121 @@
+// Package server runs the HTTP server and shuts it down gracefully: on SIGTERM
+// or SIGINT readiness turns unhealthy, in-flight requests and background tasks
+// are drained, and a second signal or SERVER_SHUTDOWN_TIMEOUT cuts the drain short.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"manage/internal/background"
+	"manage/internal/config"
+	"manage/internal/logging"
+)
+
+// draining is set once a shutdown has begun
+var draining atomic.Bool
+
+var logger = logging.For("server")
+
+// Ready reports whether the server accepts new work, i.e. is not shutting down
+func Ready() bool {
+	return !draining.Load()
+}
+
+// Listener is an additional listener such as the internal one of /metrics
+type Listener struct {
+	Name    string
+	Addr    string
+	Handler http.Handler
+}
+
+// Run serves handler, and the internal listeners, until a shutdown signal
+// arrives, then drains requests and background tasks. It returns an error if
+// a server could not start or the drain did not finish in time.
+func Run(cfg config.ServerConfig, handler http.Handler, internal ...Listener) error {
+	listeners := append([]Listener{{Name: "main", Addr: ":" + strconv.Itoa(cfg.Port), Handler: handler}}, internal...)
+	servers := make([]*http.Server, len(listeners))
+	serveErr := make(chan error, len(listeners))
+	for i, listener := range listeners {
+		srv := &http.Server{
+			Addr:              listener.Addr,
+			Handler:           listener.Handler,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		}
+		servers[i] = srv
+		if i > 0 {
+			logger.Info("Internal listener starting", "listener", listener.Name, "addr", listener.Addr)
+		}
+		go func(name string) {
+			err := srv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				err = fmt.Errorf("%s listener: %w", name, err)
+			}
+			serveErr <- err
+		}(listener.Name)
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		// Close the listeners that did start
+		for _, srv := range servers {
+			srv.Close()
+		}
+		return fmt.Errorf("failed to start server: %w", err)
+	case sig := <-signals:
+		logger.Info("Shutting down, send the signal again to stop immediately", "signal", sig.String())
+	}
+
+	draining.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-signals:
+			logger.Warn("Stopping immediately")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Keep serving while load balancers notice the failing readiness check
+	select {
+	case <-time.After(cfg.DrainDelay):
+	case <-ctx.Done():
+	}
+
+	var errs []error
+	for i, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("requests to the %s listener still in flight: %w", listeners[i].Name, err))
+		}
+	}
+	if err := background.Wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for range servers {
+		if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown incomplete: %w", errors.Join(errs...))
+	}
+	logger.Info("Server stopped")
+	return nil
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+	"manage/internal/tenancy"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when no API key exists for the ID
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrAPIKeyRevoked is returned when revoking a key that is already revoked
+	ErrAPIKeyRevoked = errors.New("API key already revoked")
+)
+
+// apiKeyPrefixLength is the number of hex characters identifying a key
+const apiKeyPrefixLength = 8
+
+// lastUsedInterval limits how often last-used tracking writes to the database
+const lastUsedInterval = time.Minute
+
+// APIKeyService manages API keys for scripts and integrations
+type APIKeyService struct {
+	securityEvents *SecurityEventService
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(securityEvents *SecurityEventService) *APIKeyService {
+	return &APIKeyService{
+		securityEvents: securityEvents,
+	}
+}
+
+// Create generates a new API key with the given scopes. The returned key is
+// not stored and cannot be shown again.
+func (aks *APIKeyService) Create(ctx context.Context, name string, scopes []string, expiresAt *time.Time, createdBy, ipAddress string) (*models.APIKey, string, error) {
+	db, err := aks.db(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefixBytes := make([]byte, apiKeyPrefixLength/2)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	prefix := hex.EncodeToString(prefixBytes)
+
+	secret, err := GenerateToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := models.APIKeyPrefix + prefix + "_" + secret
+
+	apiKey := &models.APIKey{
+		Name:      strings.TrimSpace(name),
+		Prefix:    prefix,
+		KeyHash:   HashToken(key),
+		Scopes:    models.StringList(uniqueSorted(scopes)),
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(apiKey).Error; err != nil {
+			return err
+		}
+
+		return aks.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventAPIKeyCreate,
+			Subject:   fmt.Sprintf("api_key:%d", apiKey.ID),
+			Actor:     &createdBy,
+			IPAddress: &ipAddress,
+			Details: models.JSONB{
+				"name":       apiKey.Name,
+				"scopes":     apiKey.Scopes,
+				"expires_at": apiKey.ExpiresAt,
+			},
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// List returns all API keys, newest first
+func (aks *APIKeyService) List(ctx context.Context) ([]models.APIKey, error) {
+	db, err := aks.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []models.APIKey
+	if err := db.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke disables an API key immediately
+func (aks *APIKeyService) Revoke(ctx context.Context, id uint, actor, ipAddress string) error {
+	db, err := aks.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var apiKey models.APIKey
+		err := tx.First(&apiKey, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if apiKey.RevokedAt != nil {
+			return ErrAPIKeyRevoked
+		}
+
+		if err := tx.Model(&apiKey).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return aks.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventAPIKeyRevoke,
+			Subject:   fmt.Sprintf("api_key:%d", apiKey.ID),
+			Actor:     &actor,
+			IPAddress: &ipAddress,
+			Details:   models.JSONB{"name": apiKey.Name},
+		})
+	})
+}
+
+// AuthenticateAPIKey implements middleware.APIKeyAuthenticator. It returns the
+// subject "apikey|<id>", the scopes and the site of an active key, and records
+// its use.
+func (aks *APIKeyService) AuthenticateAPIKey(ctx context.Context, key, ipAddress string) (*models.APIKeyPrincipal, error) {
+	prefix, ok := parseAPIKeyPrefix(key)
+	if !ok {
+		return nil, nil
+	}
+
+	// The key is looked up on every site; its own site is enforced afterwards
+	db, err := aks.db(tenancy.WithAllSites(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var apiKey models.APIKey
+	err = db.Where("prefix = ?", prefix).First(&apiKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(HashToken(key))) != 1 || !apiKey.IsActive() {
+		return nil, nil
+	}
+
+	// Only write when the last recorded use is older than lastUsedInterval
+	now := time.Now()
+	err = db.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-lastUsedInterval)).
+		Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ipAddress}).Error
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to record API key use", "api_key_id", apiKey.ID, "error", err)
+	}
+
+	return &models.APIKeyPrincipal{
+		Subject: fmt.Sprintf("apikey|%d", apiKey.ID),
+		Scopes:  apiKey.Scopes,
+		SiteID:  apiKey.SiteID,
+	}, nil
+}
+
+// parseAPIKeyPrefix extracts the prefix from a key of the form ccl_<prefix>_<secret>
+func parseAPIKeyPrefix(key string) (string, bool) {
+	rest := strings.TrimPrefix(key, models.APIKeyPrefix)
+	if rest == key || len(rest) <= apiKeyPrefixLength+1 || rest[apiKeyPrefixLength] != '_' {
+		return "", false
+	}
+	return rest[:apiKeyPrefixLength], true
+}
+
+// db returns the database handle bound to the context
+func (aks *APIKeyService) db(ctx context.Context) (*gorm.DB, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return db.WithContext(ctx), nil
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+	"manage/internal/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// auditChainLock is the Postgres advisory lock that serializes appends to the
+// audit hash chain
+const auditChainLock = 0x61756469 // "audi"
+
+// auditGenesisHash is the predecessor hash of the first entry
+const auditGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// AuditFilter selects audit log entries; empty fields match everything
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	// BeforeID returns only entries older than this ID, for paging
+	BeforeID uint
+}
+
+// AuditVerification is the result of checking the audit hash chain
+type AuditVerification struct {
+	Valid   bool  `json:"valid"`
+	Checked int64 `json:"checked"`
+	// FirstInvalidID is the first entry whose hash or link does not match
+	FirstInvalidID *uint `json:"first_invalid_id,omitempty"`
+}
+
+// AuditService appends entries to the tamper-evident audit log and queries it
+type AuditService struct{}
+
+// NewAuditService creates a new audit service
+func NewAuditService() *AuditService {
+	return &AuditService{}
+}
+
+// Record implements middleware.AuditRecorder. It computes the changes between
+// the before and after snapshots and appends the entry to the hash chain.
+func (as *AuditService) Record(ctx context.Context, entry *models.AuditLog) error {
+	db, err := as.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry.Changes = auditChanges(entry.Before, entry.After)
+	// Postgres stores microseconds; truncating keeps the hash reproducible
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLock).Error; err != nil {
+			return err
+		}
+
+		var last models.AuditLog
+		err := tx.Select("hash").Order("id DESC").First(&last).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			entry.PrevHash = auditGenesisHash
+		case err != nil:
+			return err
+		default:
+			entry.PrevHash = last.Hash
+		}
+
+		entry.Hash, err = auditHash(entry)
+		if err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+// List returns the newest entries matching the filter, limited to the site in
+// the context unless it is tenancy.AllSites
+func (as *AuditService) List(ctx context.Context, filter AuditFilter) ([]models.AuditLog, error) {
+	db, err := as.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	siteID, ok := tenancy.SiteFromContext(ctx)
+	if !ok {
+		return nil, tenancy.ErrNoSite
+	}
+	query := db.Order("id DESC").Limit(filter.Limit)
+	switch siteID {
+	case tenancy.AllSites:
+	case config.Get().Site.ID:
+		query = query.Where("site_id IN ?", []string{siteID, ""})
+	default:
+		query = query.Where("site_id = ?", siteID)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	var entries []models.AuditLog
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Verify recomputes the hash chain from the first entry and reports the first
+// entry that was modified, or whose predecessor was modified or removed. The
+// chain spans all sites, so every entry is checked; only the count and the ID
+// of the first invalid entry are reported.
+func (as *AuditService) Verify(ctx context.Context) (*AuditVerification, error) {
+	db, err := as.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AuditVerification{Valid: true}
+	prevHash := auditGenesisHash
+
+	var batch []models.AuditLog
+	err = db.Order("id ASC").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			entry := &batch[i]
+			result.Checked++
+
+			hash, err := auditHash(entry)
+			if err != nil {
+				return err
+			}
+			if entry.PrevHash != prevHash || entry.Hash != hash {
+				result.Valid = false
+				result.FirstInvalidID = &entry.ID
+				return errStopVerification
+			}
+			prevHash = entry.Hash
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errStopVerification) {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// errStopVerification ends the batch iteration at the first invalid entry
+var errStopVerification = errors.New("stop verification")
+
+// auditHash computes the SHA-256 hash of an entry, chained to its predecessor
+func auditHash(entry *models.AuditLog) (string, error) {
+	targetID := ""
+	if entry.TargetID != nil {
+		targetID = *entry.TargetID
+	}
+	ipAddress := ""
+	if entry.IPAddress != nil {
+		ipAddress = *entry.IPAddress
+	}
+
+	// encoding/json sorts map keys, so the JSON form of the snapshots is stable
+	fields := []interface{}{
+		entry.PrevHash,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.Actor,
+		entry.Action,
+		entry.TargetType,
+		targetID,
+		strconv.Itoa(entry.Status),
+		ipAddress,
+		emptyIfNil(entry.Before),
+		emptyIfNil(entry.After),
+		emptyIfNil(entry.Changes),
+		emptyIfNil(entry.Details),
+	}
+	// Entries recorded before sites existed have no site and keep their hashes
+	if entry.SiteID != "" {
+		fields = append(fields, entry.SiteID)
+	}
+	content, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize audit log entry: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// emptyIfNil treats a missing snapshot like an empty one, as JSONB stores nil as {}
+func emptyIfNil(snapshot models.JSONB) models.JSONB {
+	if snapshot == nil {
+		return models.JSONB{}
+	}
+	return snapshot
+}
+
+// auditChanges returns the fields that differ between two snapshots as
+// {"field": {"before": ..., "after": ...}}
+func auditChanges(before, after models.JSONB) models.JSONB {
+	if before == nil && after == nil {
+		return nil
+	}
+
+	changes := models.JSONB{}
+	for key, oldValue := range before {
+		if newValue, ok := after[key]; !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = map[string]interface{}{"before": oldValue, "after": after[key]}
+		}
+	}
+	for key, newValue := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = map[string]interface{}{"before": nil, "after": newValue}
+		}
+	}
+	return changes
+}
+
+// db returns the database handle bound to the context
+func (as *AuditService) db(ctx context.Context) (*gorm.DB, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return db.WithContext(ctx), nil
+}
@@ -0,0 +1,496 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"manage/internal/config"
+)
+
+// managementTokenLeeway renews the Management API token this long before it expires
+const managementTokenLeeway = time.Minute
+
+// maxCachedUsers bounds the user cache; expired entries are pruned beyond it
+const maxCachedUsers = 1000
+
+// auth0PasswordRealmGrant is the grant type of password logins against a
+// named database connection
+const auth0PasswordRealmGrant = "http://auth0.com/oauth/grant-type/password-realm"
+
+// Auth0TokenResponse represents the response from Auth0 token endpoint
+type Auth0TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Auth0User represents a user from Auth0 Management API
+type Auth0User struct {
+	UserID      string                 `json:"user_id"`
+	Email       string                 `json:"email"`
+	AppMetadata map[string]interface{} `json:"app_metadata"`
+}
+
+// Auth0Error represents an error from Auth0
+type Auth0Error struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Auth0IdentityProvider authenticates users with Auth0's password grant and
+// reads their roles and sites from app_metadata via the Management API.
+// Management API tokens are reused until shortly before they expire, and
+// users are cached for AUTH0_USER_CACHE_TTL.
+type Auth0IdentityProvider struct {
+	baseURL      string
+	clientID     string
+	clientSecret string
+	connection   string
+	client       *http.Client
+	retry        retryPolicy
+	users        *auth0UserCache
+
+	tokenMu     sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewAuth0IdentityProvider creates a new Auth0 identity provider. AUTH0_DOMAIN
+// is usually a bare host name; a full URL such as http://localhost:4000 points
+// the provider at a local stand-in instead.
+func NewAuth0IdentityProvider() (*Auth0IdentityProvider, error) {
+	cfg := config.Get().Auth0
+	if cfg.Domain == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, fmt.Errorf("Auth0 configuration missing")
+	}
+
+	return &Auth0IdentityProvider{
+		baseURL:      cfg.BaseURL(),
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		connection:   cfg.Connection,
+		client:       httpClient,
+		retry: retryPolicy{
+			maxAttempts: cfg.MaxAttempts,
+			baseDelay:   200 * time.Millisecond,
+			maxDelay:    5 * time.Second,
+		},
+		users: newAuth0UserCache(cfg.UserCacheTTL),
+	}, nil
+}
+
+// Name identifies the provider
+func (p *Auth0IdentityProvider) Name() string {
+	return "auth0"
+}
+
+// Authenticate authenticates the user with Auth0 using the Resource Owner
+// Password Grant. The password-realm variant is used because the plain grant
+// ignores realm and always logs in against the tenant's default directory.
+func (p *Auth0IdentityProvider) Authenticate(ctx context.Context, email, password string) (*Identity, error) {
+	payload := map[string]interface{}{
+		"grant_type":    auth0PasswordRealmGrant,
+		"username":      email,
+		"password":      password,
+		"client_id":     p.clientID,
+		"client_secret": p.clientSecret,
+		"scope":         "openid profile email",
+		"realm":         p.connection,
+	}
+
+	resp, err := p.postJSON(ctx, p.baseURL+"/oauth/token", payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var auth0Err Auth0Error
+		json.NewDecoder(resp.Body).Decode(&auth0Err)
+		if auth0Err.Error == "invalid_grant" {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("auth0 error: %s", auth0Err.ErrorDescription)
+	}
+
+	var tokenResp Auth0TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+
+	return p.LookupUser(ctx, email)
+}
+
+// LookupUser gets user information from Auth0 Management API by email
+func (p *Auth0IdentityProvider) LookupUser(ctx context.Context, email string) (*Identity, error) {
+	if user, ok := p.users.get(auth0EmailKey(email)); ok {
+		return p.identity(user), nil
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v2/users-by-email?email=%s", p.baseURL, url.QueryEscape(email))
+
+	var users []Auth0User
+	if err := p.managementGet(ctx, endpoint, &users); err != nil {
+		return nil, err
+	}
+
+	// Unknown addresses are not cached, so invited users can log in right away
+	if len(users) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	p.users.set(&users[0])
+	return p.identity(&users[0]), nil
+}
+
+// ListRoles returns the roles stored in the user's app_metadata
+func (p *Auth0IdentityProvider) ListRoles(ctx context.Context, userID string) ([]string, error) {
+	user, err := p.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return getUserRoles(user), nil
+}
+
+// ListSites returns the sites stored in the user's app_metadata
+func (p *Auth0IdentityProvider) ListSites(ctx context.Context, userID string) ([]string, error) {
+	user, err := p.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return getUserSites(user), nil
+}
+
+// CreateUser creates a user in the configured Auth0 database connection with
+// the roles and sites stored in app_metadata
+func (p *Auth0IdentityProvider) CreateUser(ctx context.Context, email, password string, roles, sites []string) (*Identity, error) {
+	appMetadata := map[string]interface{}{
+		"roles": roles,
+		"sites": sites,
+	}
+	if len(roles) > 0 {
+		appMetadata["role"] = roles[0]
+	}
+
+	payload := map[string]interface{}{
+		"email":          email,
+		"password":       password,
+		"connection":     p.connection,
+		"email_verified": true, // the invitation was delivered to this address
+		"app_metadata":   appMetadata,
+	}
+
+	var user Auth0User
+	if err := p.managementPost(ctx, p.baseURL+"/api/v2/users", payload, &user); err != nil {
+		return nil, err
+	}
+	p.users.set(&user)
+	return p.identity(&user), nil
+}
+
+// LogoutURL builds the Auth0 logout URL that returns the browser to returnTo
+func (p *Auth0IdentityProvider) LogoutURL(returnTo string) (string, error) {
+	logoutURL, err := url.Parse(p.baseURL + "/v2/logout")
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Add("client_id", p.clientID)
+	params.Add("returnTo", returnTo)
+
+	logoutURL.RawQuery = params.Encode()
+
+	return logoutURL.String(), nil
+}
+
+// getUser gets a user by ID from Auth0 Management API
+func (p *Auth0IdentityProvider) getUser(ctx context.Context, userID string) (*Auth0User, error) {
+	if user, ok := p.users.get(auth0IDKey(userID)); ok {
+		return user, nil
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v2/users/%s", p.baseURL, url.PathEscape(userID))
+
+	var user Auth0User
+	if err := p.managementGet(ctx, endpoint, &user); err != nil {
+		return nil, err
+	}
+	p.users.set(&user)
+	return &user, nil
+}
+
+// managementGet performs an authenticated GET request against the Management API
+func (p *Auth0IdentityProvider) managementGet(ctx context.Context, endpoint string, out interface{}) error {
+	resp, err := p.managementRequest(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUserNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to get user from Auth0: %s", string(body))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// managementPost performs an authenticated POST request against the Management API
+func (p *Auth0IdentityProvider) managementPost(ctx context.Context, endpoint string, payload, out interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.managementRequest(ctx, "POST", endpoint, jsonData)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return ErrUserExists
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var mgmtErr struct {
+			ErrorCode string `json:"errorCode"`
+			Message   string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&mgmtErr)
+		if mgmtErr.ErrorCode == "PasswordStrengthError" || mgmtErr.ErrorCode == "PasswordNoUserInfoError" {
+			return fmt.Errorf("%w: %s", ErrWeakPassword, mgmtErr.Message)
+		}
+		return fmt.Errorf("Auth0 request failed with status %d: %s", resp.StatusCode, mgmtErr.Message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// managementRequest sends an authenticated request to the Management API.
+// Only GET requests are retried on server errors, so users are never created
+// twice. A rejected token is renewed once.
+func (p *Auth0IdentityProvider) managementRequest(ctx context.Context, method, endpoint string, body []byte) (*http.Response, error) {
+	for renewed := false; ; renewed = true {
+		mgmtToken, err := p.getManagementToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get management token: %w", err)
+		}
+
+		resp, err := doWithRetry(ctx, p.client, p.retry, method == "GET", func() (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			if body != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			req.Header.Set("Authorization", "Bearer "+mgmtToken)
+			return req, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized || renewed {
+			return resp, nil
+		}
+		resp.Body.Close()
+		p.invalidateManagementToken(mgmtToken)
+	}
+}
+
+// getManagementToken returns a cached access token for the Management API, or
+// requests a new one when it is about to expire. Concurrent callers wait for
+// a single token request.
+func (p *Auth0IdentityProvider) getManagementToken(ctx context.Context) (string, error) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	payload := map[string]interface{}{
+		"grant_type":    "client_credentials",
+		"client_id":     p.clientID,
+		"client_secret": p.clientSecret,
+		"audience":      p.baseURL + "/api/v2/",
+	}
+
+	resp, err := p.postJSON(ctx, p.baseURL+"/oauth/token", payload)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get management token: %s", string(body))
+	}
+
+	var tokenResp Auth0TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("no access token in response")
+	}
+
+	// Tokens without a lifetime are used once; short-lived ones are renewed halfway
+	lifetime := time.Duration(tokenResp.ExpiresIn) * time.Second
+	p.token = tokenResp.AccessToken
+	p.tokenExpiry = time.Now().Add(lifetime - min(managementTokenLeeway, lifetime/2))
+
+	return p.token, nil
+}
+
+// invalidateManagementToken drops the cached token if it is still the given
+// one, e.g. after the Management API rejected it
+func (p *Auth0IdentityProvider) invalidateManagementToken(token string) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+	if p.token == token {
+		p.token = ""
+	}
+}
+
+// postJSON sends a JSON POST request to the token endpoint, retrying on rate
+// limits and server errors
+func (p *Auth0IdentityProvider) postJSON(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return doWithRetry(ctx, p.client, p.retry, true, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
+
+// identity converts an Auth0 user into an Identity
+func (p *Auth0IdentityProvider) identity(user *Auth0User) *Identity {
+	return &Identity{
+		ID:    user.UserID,
+		Email: user.Email,
+		Roles: getUserRoles(user),
+		Sites: getUserSites(user),
+	}
+}
+
+// getUserRoles extracts roles from user's app metadata, supporting both a
+// single "role" and a "roles" list
+func getUserRoles(user *Auth0User) []string {
+	roles := []string{}
+	if user.AppMetadata == nil {
+		return roles
+	}
+	if role, ok := user.AppMetadata["role"].(string); ok && role != "" {
+		roles = append(roles, role)
+	}
+	roles = append(roles, toStringSlice(user.AppMetadata["roles"])...)
+	return roles
+}
+
+// getUserSites extracts sites from user's app metadata
+func getUserSites(user *Auth0User) []string {
+	if user.AppMetadata == nil {
+		return []string{}
+	}
+	return toStringSlice(user.AppMetadata["sites"])
+}
+
+// toStringSlice converts a decoded JSON array into a string slice, skipping non-strings
+func toStringSlice(value interface{}) []string {
+	result := []string{}
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+	}
+	return result
+}
+
+// auth0UserCache keeps users from the Management API for a short time, keyed
+// by ID and by email, so repeated logins and role lookups skip the API
+type auth0UserCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedAuth0User
+}
+
+type cachedAuth0User struct {
+	user      *Auth0User
+	expiresAt time.Time
+}
+
+func newAuth0UserCache(ttl time.Duration) *auth0UserCache {
+	return &auth0UserCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedAuth0User),
+	}
+}
+
+// get returns a cached user that has not expired
+func (c *auth0UserCache) get(key string) (*Auth0User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.user, true
+}
+
+// set caches a user under its ID and its email
+func (c *auth0UserCache) set(user *Auth0User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxCachedUsers {
+		for key, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxCachedUsers {
+			c.entries = make(map[string]cachedAuth0User)
+		}
+	}
+
+	entry := cachedAuth0User{user: user, expiresAt: now.Add(c.ttl)}
+	if user.UserID != "" {
+		c.entries[auth0IDKey(user.UserID)] = entry
+	}
+	if user.Email != "" {
+		c.entries[auth0EmailKey(user.Email)] = entry
+	}
+}
+
+func auth0IDKey(userID string) string {
+	return "id:" + userID
+}
+
+func auth0EmailKey(email string) string {
+	return "email:" + normalizeEmail(email)
+}
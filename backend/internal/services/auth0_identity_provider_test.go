@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"manage/internal/services/auth0test"
+)
+
+// newTestAuth0Provider returns a provider talking to a fresh auth0test server
+func newTestAuth0Provider(t *testing.T, userCacheTTL time.Duration) (*Auth0IdentityProvider, *auth0test.Server) {
+	t.Helper()
+	server := auth0test.NewServer("client", "secret")
+	t.Cleanup(server.Close)
+
+	provider := &Auth0IdentityProvider{
+		baseURL:      server.URL,
+		clientID:     "client",
+		clientSecret: "secret",
+		connection:   auth0test.DefaultConnection,
+		client:       server.Client(),
+		retry:        retryPolicy{maxAttempts: 3, baseDelay: time.Millisecond, maxDelay: 10 * time.Millisecond},
+		users:        newAuth0UserCache(userCacheTTL),
+	}
+	return provider, server
+}
+
+func TestAuth0Authenticate(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, time.Minute)
+	server.AddUser("anna@example.com", "correct horse", map[string]interface{}{"roles": []interface{}{"admin"}})
+
+	user, err := provider.Authenticate(context.Background(), "anna@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Email != "anna@example.com" || len(user.Roles) != 1 || user.Roles[0] != "admin" {
+		t.Errorf("Authenticate returned %+v", user)
+	}
+
+	if _, err := provider.Authenticate(context.Background(), "anna@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate with a wrong password returned %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAuth0AuthenticateUsesConfiguredConnection(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, time.Minute)
+	server.SetConnection("members")
+	server.AddUser("anna@example.com", "correct horse", nil)
+
+	if _, err := provider.Authenticate(context.Background(), "anna@example.com", "correct horse"); err == nil {
+		t.Fatal("Authenticate against another connection succeeded")
+	}
+
+	provider.connection = "members"
+	if _, err := provider.Authenticate(context.Background(), "anna@example.com", "correct horse"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if _, err := provider.CreateUser(context.Background(), "ben@example.com", "long enough", []string{"editor"}, nil); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	// Like Auth0, the server ignores realm on the plain password grant
+	body := `{"grant_type":"password","client_id":"client","client_secret":"secret","username":"anna@example.com","password":"correct horse","realm":"members"}`
+	resp, err := server.Client().Post(server.URL+"/oauth/token", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Error("the plain password grant logged in against the realm instead of the default directory")
+	}
+}
+
+func TestAuth0ManagementTokenIsReused(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, time.Minute)
+	server.SetTokenLifetime(3600)
+	server.AddUser("anna@example.com", "pw", nil)
+	server.AddUser("ben@example.com", "pw", nil)
+
+	ctx := context.Background()
+	for _, email := range []string{"anna@example.com", "ben@example.com", "unknown@example.com"} {
+		if _, err := provider.LookupUser(ctx, email); err != nil && !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("LookupUser(%s): %v", email, err)
+		}
+	}
+	if got := server.Requests("token"); got != 1 {
+		t.Errorf("token requested %d times, want 1", got)
+	}
+
+	// The token is kept until expires_in minus the leeway
+	wantExpiry := time.Now().Add(3600*time.Second - managementTokenLeeway)
+	if d := provider.tokenExpiry.Sub(wantExpiry); d > time.Second || d < -time.Second {
+		t.Errorf("token expires at %v, want about %v", provider.tokenExpiry, wantExpiry)
+	}
+
+	// Once that point has passed a new token is requested
+	provider.tokenExpiry = time.Now().Add(-time.Millisecond)
+	if _, err := provider.LookupUser(ctx, "unknown@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("LookupUser: %v", err)
+	}
+	if got := server.Requests("token"); got != 2 {
+		t.Errorf("token requested %d times after expiry, want 2", got)
+	}
+}
+
+func TestAuth0ManagementTokenRenewedAfterUnauthorized(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, time.Minute)
+	server.AddUser("anna@example.com", "pw", nil)
+	server.AddUser("ben@example.com", "pw", nil)
+
+	ctx := context.Background()
+	if _, err := provider.LookupUser(ctx, "anna@example.com"); err != nil {
+		t.Fatalf("LookupUser: %v", err)
+	}
+
+	server.RevokeTokens()
+	if _, err := provider.LookupUser(ctx, "ben@example.com"); err != nil {
+		t.Fatalf("LookupUser after the token was revoked: %v", err)
+	}
+	if got := server.Requests("token"); got != 2 {
+		t.Errorf("token requested %d times, want 2", got)
+	}
+	if got := server.Requests("users-by-email"); got != 3 {
+		t.Errorf("users-by-email requested %d times, want 3 (one rejected)", got)
+	}
+}
+
+func TestAuth0UserCacheExpires(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, 50*time.Millisecond)
+	id := server.AddUser("anna@example.com", "pw", map[string]interface{}{"role": "editor"})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := provider.LookupUser(ctx, "anna@example.com"); err != nil {
+			t.Fatalf("LookupUser: %v", err)
+		}
+	}
+	if roles, err := provider.ListRoles(ctx, id); err != nil || len(roles) != 1 || roles[0] != "editor" {
+		t.Fatalf("ListRoles returned %v, %v", roles, err)
+	}
+	if got := server.Requests("users-by-email") + server.Requests("user"); got != 1 {
+		t.Errorf("Management API called %d times within the TTL, want 1", got)
+	}
+
+	server.SetAppMetadata(id, map[string]interface{}{"role": "admin"})
+	time.Sleep(60 * time.Millisecond)
+
+	roles, err := provider.ListRoles(ctx, id)
+	if err != nil {
+		t.Fatalf("ListRoles: %v", err)
+	}
+	if len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("ListRoles after the TTL returned %v, want [admin]", roles)
+	}
+	if got := server.Requests("user"); got != 1 {
+		t.Errorf("users endpoint called %d times after the TTL, want 1", got)
+	}
+}
+
+func TestAuth0RetriesIdempotentRequests(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, time.Minute)
+	server.AddUser("anna@example.com", "pw", nil)
+
+	server.FailNext("token", http.StatusTooManyRequests)
+	server.FailNext("users-by-email", http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	if _, err := provider.LookupUser(context.Background(), "anna@example.com"); err != nil {
+		t.Fatalf("LookupUser: %v", err)
+	}
+	if got := server.Requests("token"); got != 2 {
+		t.Errorf("token requested %d times, want 2", got)
+	}
+	if got := server.Requests("users-by-email"); got != 3 {
+		t.Errorf("users-by-email requested %d times, want 3", got)
+	}
+}
+
+func TestAuth0GivesUpAfterMaxAttempts(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, time.Minute)
+
+	server.FailNext("users-by-email", http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	if _, err := provider.LookupUser(context.Background(), "anna@example.com"); err == nil {
+		t.Fatal("LookupUser succeeded although every attempt failed")
+	}
+	if got := server.Requests("users-by-email"); got != 3 {
+		t.Errorf("users-by-email requested %d times, want 3", got)
+	}
+}
+
+func TestAuth0DoesNotRetryNonIdempotentRequests(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, time.Minute)
+	ctx := context.Background()
+
+	server.FailNext("create-user", http.StatusServiceUnavailable)
+	if _, err := provider.CreateUser(ctx, "anna@example.com", "long enough", []string{"editor"}, nil); err == nil {
+		t.Fatal("CreateUser succeeded although the server failed")
+	}
+	if got := server.Requests("create-user"); got != 1 {
+		t.Errorf("create-user requested %d times after a 503, want 1", got)
+	}
+
+	// Rate limited requests were not processed, so they are retried
+	server.FailNext("create-user", http.StatusTooManyRequests)
+	if _, err := provider.CreateUser(ctx, "anna@example.com", "long enough", []string{"editor"}, nil); err != nil {
+		t.Fatalf("CreateUser after a 429: %v", err)
+	}
+	if got := server.Requests("create-user"); got != 3 {
+		t.Errorf("create-user requested %d times, want 3", got)
+	}
+}
+
+func TestAuth0HonoursRetryAfter(t *testing.T) {
+	provider, server := newTestAuth0Provider(t, time.Minute)
+	// The backoff alone would wait far longer than the test runs
+	provider.retry = retryPolicy{maxAttempts: 2, baseDelay: time.Minute, maxDelay: time.Minute}
+
+	server.FailNext("token", http.StatusTooManyRequests) // Retry-After: 0
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := provider.getManagementToken(ctx); err != nil {
+		t.Fatalf("getManagementToken: %v", err)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 3, baseDelay: 100 * time.Millisecond, maxDelay: 5 * time.Second}
+	withRetryAfter := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{value}}}
+	}
+
+	if got := policy.backoff(1, withRetryAfter("2")); got != 2*time.Second {
+		t.Errorf("backoff with Retry-After: 2 = %v, want 2s", got)
+	}
+	if got := policy.backoff(1, withRetryAfter("120")); got != policy.maxDelay {
+		t.Errorf("backoff with Retry-After: 120 = %v, want maxDelay", got)
+	}
+	date := time.Now().Add(3 * time.Second).UTC().Format(http.TimeFormat)
+	if got := policy.backoff(1, withRetryAfter(date)); got <= time.Second || got > 3*time.Second {
+		t.Errorf("backoff with Retry-After: %s = %v, want about 3s", date, got)
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		limit := policy.baseDelay << (attempt - 1)
+		if got := policy.backoff(attempt, nil); got < limit/2 || got > limit {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, got, limit/2, limit)
+		}
+	}
+}
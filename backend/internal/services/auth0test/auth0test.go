@@ -0,0 +1,305 @@
+// Package auth0test provides a local stand-in for the Auth0 authentication and
+// Management APIs, so the Auth0 identity provider can be exercised without a
+// tenant. Point AUTH0_DOMAIN at Server.URL to use it.
+package auth0test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultConnection is the database connection of new servers, like in a new
+// Auth0 tenant
+const DefaultConnection = "Username-Password-Authentication"
+
+// passwordRealmGrant is the grant type of password logins against a named
+// connection
+const passwordRealmGrant = "http://auth0.com/oauth/grant-type/password-realm"
+
+// User is an account known to the server
+type User struct {
+	UserID      string                 `json:"user_id"`
+	Email       string                 `json:"email"`
+	AppMetadata map[string]interface{} `json:"app_metadata"`
+
+	password string
+}
+
+// Server answers the token, users-by-email and users endpoints used by the
+// identity provider and counts the requests it receives
+type Server struct {
+	*httptest.Server
+
+	clientID     string
+	clientSecret string
+
+	mu            sync.Mutex
+	connection    string
+	users         map[string]*User
+	tokens        map[string]bool
+	tokenLifetime int
+	issued        int
+	requests      map[string]int
+	failures      map[string][]int
+}
+
+// NewServer starts a server that accepts the given client credentials
+func NewServer(clientID, clientSecret string) *Server {
+	s := &Server{
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		connection:    DefaultConnection,
+		users:         make(map[string]*User),
+		tokens:        make(map[string]bool),
+		tokenLifetime: 86400,
+		requests:      make(map[string]int),
+		failures:      make(map[string][]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", s.count("token", s.serveToken))
+	mux.HandleFunc("GET /api/v2/users-by-email", s.count("users-by-email", s.authorized(s.serveUsersByEmail)))
+	mux.HandleFunc("GET /api/v2/users/{id}", s.count("user", s.authorized(s.serveUser)))
+	mux.HandleFunc("POST /api/v2/users", s.count("create-user", s.authorized(s.serveCreateUser)))
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// AddUser creates an account in the database connection and returns its ID
+func (s *Server) AddUser(email, password string, appMetadata map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addUser(email, password, appMetadata).UserID
+}
+
+// SetAppMetadata replaces the app_metadata of a user, e.g. to change their roles
+func (s *Server) SetAppMetadata(userID string, appMetadata map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[userID]; ok {
+		user.AppMetadata = appMetadata
+	}
+}
+
+// SetConnection renames the database connection that holds the users.
+// Password-realm logins and new users naming another connection are rejected.
+// Like Auth0, the plain password grant ignores realm and only finds users of
+// the default directory, DefaultConnection.
+func (s *Server) SetConnection(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connection = name
+}
+
+// SetTokenLifetime sets the expires_in of Management API tokens issued from now on
+func (s *Server) SetTokenLifetime(seconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenLifetime = seconds
+}
+
+// RevokeTokens invalidates all Management API tokens issued so far
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]bool)
+}
+
+// FailNext makes the next requests to an endpoint fail with the given
+// statuses, one per request. Endpoints are named "token", "users-by-email",
+// "user" and "create-user". 429 responses carry Retry-After: 0.
+func (s *Server) FailNext(endpoint string, statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], statuses...)
+}
+
+// Requests returns how many requests an endpoint received, including failed ones
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+// count records a request to the endpoint and answers with a queued failure, if any
+func (s *Server) count(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[endpoint]++
+		var status int
+		if queued := s.failures[endpoint]; len(queued) > 0 {
+			status, s.failures[endpoint] = queued[0], queued[1:]
+		}
+		s.mu.Unlock()
+
+		if status != 0 {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			writeJSON(w, status, map[string]string{"error": http.StatusText(status)})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authorized rejects Management API requests without a valid token
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mu.Lock()
+		valid := s.tokens[token]
+		s.mu.Unlock()
+
+		if !valid {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized", "message": "Invalid token"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GrantType    string `json:"grant_type"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		Username     string `json:"username"`
+		Password     string `json:"password"`
+		Realm        string `json:"realm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if req.ClientID != s.clientID || req.ClientSecret != s.clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "access_denied", "error_description": "Unauthorized"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.GrantType {
+	case "client_credentials":
+		s.issued++
+		token := "mgmt-" + strconv.Itoa(s.issued)
+		s.tokens[token] = true
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   s.tokenLifetime,
+		})
+	case "password", passwordRealmGrant:
+		// The plain grant ignores realm and logs in against the default directory
+		connection := DefaultConnection
+		if req.GrantType == passwordRealmGrant {
+			if req.Realm != s.connection {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": "connection is not enabled"})
+				return
+			}
+			connection = req.Realm
+		}
+		user := s.findByEmail(req.Username)
+		if connection != s.connection || user == nil || user.password != req.Password {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "invalid_grant", "error_description": "Wrong email or password."})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": "user-" + user.UserID,
+			"token_type":   "Bearer",
+			"expires_in":   86400,
+		})
+	default:
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "unsupported_grant_type"})
+	}
+}
+
+func (s *Server) serveUsersByEmail(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []*User{}
+	if user := s.findByEmail(r.URL.Query().Get("email")); user != nil {
+		users = append(users, user)
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) serveUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[r.PathValue("id")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not Found", "message": "The user does not exist."})
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) serveCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email       string                 `json:"email"`
+		Password    string                 `json:"password"`
+		Connection  string                 `json:"connection"`
+		AppMetadata map[string]interface{} `json:"app_metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Bad Request"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.Connection != s.connection {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Bad Request", "message": "The connection does not exist."})
+		return
+	}
+	if s.findByEmail(req.Email) != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Conflict", "message": "The user already exists."})
+		return
+	}
+	if len(req.Password) < 8 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errorCode": "PasswordStrengthError", "message": "Password is too weak"})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s.addUser(req.Email, req.Password, req.AppMetadata))
+}
+
+// addUser stores a new user; the caller holds s.mu
+func (s *Server) addUser(email, password string, appMetadata map[string]interface{}) *User {
+	user := &User{
+		UserID:      fmt.Sprintf("auth0|%d", len(s.users)+1),
+		Email:       email,
+		AppMetadata: appMetadata,
+		password:    password,
+	}
+	s.users[user.UserID] = user
+	return user
+}
+
+// findByEmail returns the user with the address, ignoring case; the caller holds s.mu
+func (s *Server) findByEmail(email string) *User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
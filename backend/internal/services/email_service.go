@@ -1,11 +1,21 @@
 package services
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/smtp"
-	"os"
+	"strconv"
 	"strings"
+
+	"manage/internal/config"
+	"manage/internal/logging"
+	"manage/internal/metrics"
+	"manage/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // EmailService handles sending emails via SMTP
@@ -15,16 +25,20 @@ type EmailService struct {
 	smtpUser     string
 	smtpPassword string
 	fromEmail    string
+	// notificationEmails receive the notifications about new contact requests
+	notificationEmails []string
 }
 
 // NewEmailService creates a new email service
 func NewEmailService() *EmailService {
+	cfg := config.Get().SMTP
 	return &EmailService{
-		smtpHost:     getEnv("SMTP_HOST", ""),
-		smtpPort:     getEnv("SMTP_PORT", "587"),
-		smtpUser:     getEnv("SMTP_USER", ""),
-		smtpPassword: getEnv("SMTP_PASS", ""),
-		fromEmail:    getEnv("SMTP_FROM", getEnv("SMTP_USER", "noreply@cc-lippstadt.com")),
+		smtpHost:           cfg.Host,
+		smtpPort:           strconv.Itoa(cfg.Port),
+		smtpUser:           cfg.User,
+		smtpPassword:       cfg.Password,
+		fromEmail:          cfg.From,
+		notificationEmails: cfg.NotificationEmails,
 	}
 }
 
@@ -36,22 +50,43 @@ func (es *EmailService) IsConfigured() bool {
 }
 
 // SendNotificationEmail sends a notification email to the configured recipients
-func (es *EmailService) SendNotificationEmail(subject, body string) error {
+func (es *EmailService) SendNotificationEmail(ctx context.Context, subject, body string) error {
 	if !es.IsConfigured() {
 		return fmt.Errorf("SMTP not configured")
 	}
 
-	notificationEmails := getEnv("NOTIFICATION_EMAILS", "")
-	if notificationEmails == "" {
+	if len(es.notificationEmails) == 0 {
 		return fmt.Errorf("NOTIFICATION_EMAILS not configured")
 	}
 
-	// Split comma-separated emails
-	recipients := strings.Split(notificationEmails, ",")
-	for i, email := range recipients {
-		recipients[i] = strings.TrimSpace(email)
+	return es.SendEmail(ctx, es.notificationEmails, subject, body)
+}
+
+// SendEmail sends an HTML email to the given recipients
+func (es *EmailService) SendEmail(ctx context.Context, recipients []string, subject, body string) error {
+	if !es.IsConfigured() {
+		return fmt.Errorf("SMTP not configured")
 	}
 
+	_, span := tracing.Tracer().Start(ctx, "smtp send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("server.address", es.smtpHost),
+			attribute.Int("email.recipients", len(recipients)),
+		),
+	)
+	defer span.End()
+
+	err := es.send(recipients, subject, body)
+	metrics.EmailSent(err)
+	if err != nil {
+		span.SetStatus(codes.Error, logging.RedactString(err.Error()))
+	}
+	return err
+}
+
+// send delivers the message to the SMTP server
+func (es *EmailService) send(recipients []string, subject, body string) error {
 	// Build email message
 	message := fmt.Sprintf("From: %s\r\n", es.fromEmail)
 	message += fmt.Sprintf("To: %s\r\n", strings.Join(recipients, ", "))
@@ -169,12 +204,3 @@ func (es *EmailService) SendNotificationEmail(subject, body string) error {
 
 	return client.Quit()
 }
-
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
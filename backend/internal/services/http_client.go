@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"manage/internal/tracing"
+)
+
+// httpClient is shared by all calls to external APIs, so connections are
+// pooled and reused instead of being opened for every request
+var httpClient = &http.Client{
+	Timeout: 10 * time.Second,
+	// Every call is traced as a child of the span in its request context
+	Transport: tracing.Transport(&http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}),
+}
+
+// retryPolicy controls how often and how long failed requests are retried
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// doWithRetry sends the request built by newRequest and retries it with
+// exponential backoff when the server answers 429 Too Many Requests. Idempotent
+// requests are also retried on 5xx responses and network errors. A Retry-After
+// header takes precedence over the backoff, up to maxDelay.
+func doWithRetry(ctx context.Context, client *http.Client, policy retryPolicy, idempotent bool, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		retry := false
+		if err != nil {
+			retry = idempotent && ctx.Err() == nil
+		} else {
+			retry = resp.StatusCode == http.StatusTooManyRequests || (idempotent && resp.StatusCode >= 500)
+		}
+		if !retry || attempt >= policy.maxAttempts {
+			return resp, err
+		}
+
+		delay := policy.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt: the Retry-After header
+// if present, otherwise an exponentially growing delay with jitter
+func (rp retryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, rp.maxDelay)
+		}
+		if date, err := http.ParseTime(resp.Header.Get("Retry-After")); err == nil {
+			return min(max(time.Until(date), 0), rp.maxDelay)
+		}
+	}
+
+	delay := min(rp.baseDelay<<(attempt-1), rp.maxDelay)
+	// Jitter spreads out retries of concurrent requests
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
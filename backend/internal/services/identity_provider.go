@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"manage/internal/config"
+	"manage/internal/repository"
+)
+
+var (
+	// ErrInvalidCredentials is returned when the email/password combination is wrong
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrUserNotFound is returned when no user exists for the given email or ID
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a user whose email is already registered
+	ErrUserExists = errors.New("user already exists")
+	// ErrWeakPassword is returned when a new password does not meet the provider's policy
+	ErrWeakPassword = errors.New("password does not meet the requirements")
+)
+
+// Identity represents a user as known to an identity provider
+type Identity struct {
+	ID    string   `json:"id"`
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
+	Sites []string `json:"sites"`
+}
+
+// PrimaryRole returns the first role of the identity, or "" when it has none
+func (i *Identity) PrimaryRole() string {
+	if len(i.Roles) == 0 {
+		return ""
+	}
+	return i.Roles[0]
+}
+
+// IdentityProvider authenticates admin users and resolves their roles and sites
+type IdentityProvider interface {
+	// Name identifies the provider, e.g. in logs
+	Name() string
+	// Authenticate verifies the credentials and returns the matching identity.
+	// It returns ErrInvalidCredentials when they are wrong.
+	Authenticate(ctx context.Context, email, password string) (*Identity, error)
+	// LookupUser returns the identity registered for the email address
+	LookupUser(ctx context.Context, email string) (*Identity, error)
+	// ListRoles returns the roles of the user with the given ID
+	ListRoles(ctx context.Context, userID string) ([]string, error)
+	// ListSites returns the sites the user with the given ID may manage
+	ListSites(ctx context.Context, userID string) ([]string, error)
+}
+
+// LogoutURLProvider is implemented by providers that keep their own session
+// and need the browser sent to them on logout
+type LogoutURLProvider interface {
+	LogoutURL(returnTo string) (string, error)
+}
+
+// UserCreator is implemented by providers that can create accounts, e.g. when
+// an invitation is accepted
+type UserCreator interface {
+	// CreateUser registers a new user. It returns ErrUserExists or
+	// ErrWeakPassword (wrapped with details) when the user cannot be created.
+	CreateUser(ctx context.Context, email, password string, roles, sites []string) (*Identity, error)
+}
+
+// NewIdentityProvider creates the identity provider selected by IDENTITY_PROVIDER.
+// The configuration defaults it to Auth0 when AUTH0_DOMAIN is set and to the local provider otherwise,
+// which keeps its accounts in users.
+func NewIdentityProvider(users repository.UserRepository) (IdentityProvider, error) {
+	name := config.Get().Auth.IdentityProvider
+	switch name {
+	case "auth0":
+		return NewAuth0IdentityProvider()
+	case "local":
+		return NewLocalIdentityProvider(users), nil
+	default:
+		return nil, fmt.Errorf("unknown identity provider %q", name)
+	}
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+	"manage/internal/tenancy"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvitationNotFound is returned when no invitation exists for the ID or token
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvitationNotPending is returned when the invitation was accepted, revoked or has expired
+	ErrInvitationNotPending = errors.New("invitation is no longer pending")
+	// ErrInvitationExists is returned when a pending invitation for the email already exists
+	ErrInvitationExists = errors.New("a pending invitation for this email already exists")
+	// ErrInvitationEmailFailed is returned when the invitation was saved but could not be emailed
+	ErrInvitationEmailFailed = errors.New("failed to send invitation email")
+)
+
+// InvitationService invites new admins by email and turns accepted
+// invitations into accounts
+type InvitationService struct {
+	ttl            time.Duration
+	acceptURL      string
+	organization   string
+	emailService   *EmailService
+	securityEvents *SecurityEventService
+}
+
+// NewInvitationService creates a new invitation service. Invitation emails
+// link to INVITATION_URL with the token as ?token=.
+func NewInvitationService(emailService *EmailService, securityEvents *SecurityEventService) *InvitationService {
+	return &InvitationService{
+		ttl:            config.Get().Auth.InvitationTTL,
+		acceptURL:      config.Get().Auth.InvitationURL,
+		organization:   config.Get().Site.OrganizationName,
+		emailService:   emailService,
+		securityEvents: securityEvents,
+	}
+}
+
+// Create saves an invitation and emails it. When only the email fails, the
+// invitation is returned together with ErrInvitationEmailFailed, so it can be resent.
+func (is *InvitationService) Create(ctx context.Context, email string, roles, sites []string, invitedBy, ipAddress string) (*models.Invitation, error) {
+	db, err := is.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	email = strings.TrimSpace(email)
+	invitation := &models.Invitation{
+		Email:     email,
+		Roles:     models.StringList(roles),
+		Sites:     models.StringList(sites),
+		InvitedBy: invitedBy,
+	}
+
+	var token string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var pending int64
+		err := tx.Model(&models.Invitation{}).
+			Where("LOWER(email) = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", normalizeEmail(email), time.Now()).
+			Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrInvitationExists
+		}
+
+		if token, err = is.renewToken(invitation); err != nil {
+			return err
+		}
+		if err := tx.Create(invitation).Error; err != nil {
+			return err
+		}
+
+		return is.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventInviteCreate,
+			Subject:   fmt.Sprintf("invitation:%d", invitation.ID),
+			Actor:     &invitedBy,
+			IPAddress: &ipAddress,
+			Details: models.JSONB{
+				"roles": roles,
+				"sites": sites,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := is.send(ctx, invitation, token); err != nil {
+		return invitation, err
+	}
+	return invitation, nil
+}
+
+// List returns the invitations to the site in the context, newest first,
+// optionally only those with the given status
+func (is *InvitationService) List(ctx context.Context, status string) ([]models.Invitation, error) {
+	db, err := is.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	query := db.Scopes(invitationSiteScope(ctx)).Order("created_at DESC")
+	switch status {
+	case "":
+	case models.InvitationStatusPending:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	case models.InvitationStatusAccepted:
+		query = query.Where("accepted_at IS NOT NULL")
+	case models.InvitationStatusRevoked:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NOT NULL")
+	case models.InvitationStatusExpired:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	default:
+		return nil, fmt.Errorf("unknown invitation status %q", status)
+	}
+
+	var invitations []models.Invitation
+	if err := query.Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// Resend issues a new token for a pending or expired invitation, restarts its
+// expiry and emails it again. Links sent earlier stop working.
+func (is *InvitationService) Resend(ctx context.Context, id uint, actor, ipAddress string) (*models.Invitation, error) {
+	db, err := is.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitation models.Invitation
+	var token string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := is.lock(tx, "id = ?", id).Scopes(invitationSiteScope(ctx)).First(&invitation).Error; err != nil {
+			return is.notFound(err)
+		}
+		if status := invitation.Status(); status != models.InvitationStatusPending && status != models.InvitationStatusExpired {
+			return ErrInvitationNotPending
+		}
+
+		renewed, err := is.renewToken(&invitation)
+		if err != nil {
+			return err
+		}
+		token = renewed
+		if err := tx.Save(&invitation).Error; err != nil {
+			return err
+		}
+
+		return is.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventInviteResend,
+			Subject:   fmt.Sprintf("invitation:%d", invitation.ID),
+			Actor:     &actor,
+			IPAddress: &ipAddress,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := is.send(ctx, &invitation, token); err != nil {
+		return &invitation, err
+	}
+	return &invitation, nil
+}
+
+// Revoke withdraws a pending invitation, so its link stops working
+func (is *InvitationService) Revoke(ctx context.Context, id uint, actor, ipAddress string) error {
+	db, err := is.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.Invitation
+		if err := is.lock(tx, "id = ?", id).Scopes(invitationSiteScope(ctx)).First(&invitation).Error; err != nil {
+			return is.notFound(err)
+		}
+		if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+			return ErrInvitationNotPending
+		}
+
+		if err := tx.Model(&invitation).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return is.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventInviteRevoke,
+			Subject:   fmt.Sprintf("invitation:%d", invitation.ID),
+			Actor:     &actor,
+			IPAddress: &ipAddress,
+		})
+	})
+}
+
+// Lookup returns the pending invitation for a token, e.g. to show the invitee
+// which address and roles they are accepting
+func (is *InvitationService) Lookup(ctx context.Context, token string) (*models.Invitation, error) {
+	db, err := is.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitation models.Invitation
+	if err := db.Where("token_hash = ?", HashToken(token)).First(&invitation).Error; err != nil {
+		return nil, is.notFound(err)
+	}
+	if invitation.Status() != models.InvitationStatusPending {
+		return nil, ErrInvitationNotPending
+	}
+	return &invitation, nil
+}
+
+// Accept creates the invited account with the chosen password through the
+// identity provider and marks the invitation as accepted
+func (is *InvitationService) Accept(ctx context.Context, token, password string, creator UserCreator, ipAddress string) (*Identity, error) {
+	db, err := is.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity *Identity
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.Invitation
+		if err := is.lock(tx, "token_hash = ?", HashToken(token)).First(&invitation).Error; err != nil {
+			return is.notFound(err)
+		}
+		if invitation.Status() != models.InvitationStatusPending {
+			return ErrInvitationNotPending
+		}
+
+		created, err := creator.CreateUser(ctx, invitation.Email, password, invitation.Roles, invitation.Sites)
+		if err != nil {
+			return err
+		}
+		identity = created
+
+		err = tx.Model(&invitation).Updates(map[string]interface{}{
+			"accepted_at": time.Now(),
+			"user_id":     created.ID,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return is.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventInviteAccept,
+			Subject:   fmt.Sprintf("invitation:%d", invitation.ID),
+			Actor:     &created.ID,
+			IPAddress: &ipAddress,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// renewToken sets a new token and expiry on the invitation and returns the token
+func (is *InvitationService) renewToken(invitation *models.Invitation) (string, error) {
+	token, err := GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+	invitation.TokenHash = HashToken(token)
+	invitation.ExpiresAt = time.Now().Add(is.ttl)
+	return token, nil
+}
+
+// send emails the invitation link and records the delivery
+func (is *InvitationService) send(ctx context.Context, invitation *models.Invitation, token string) error {
+	link := is.acceptURL + "?token=" + url.QueryEscape(token)
+	subject := fmt.Sprintf("Invitation to the %s admin area", is.organization)
+
+	if err := is.emailService.SendEmail(ctx, []string{invitation.Email}, subject, is.emailBody(link, invitation.ExpiresAt)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvitationEmailFailed, err)
+	}
+
+	db, err := is.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	invitation.LastSentAt = &now
+	invitation.SendCount++
+	return db.Model(invitation).Updates(map[string]interface{}{
+		"last_sent_at": now,
+		"send_count":   gorm.Expr("send_count + 1"),
+	}).Error
+}
+
+// emailBody renders the HTML invitation email
+func (is *InvitationService) emailBody(link string, expiresAt time.Time) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; margin: 0; padding: 20px; background-color: #f9f9f9;">
+	<div style="max-width: 600px; margin: 0 auto; background-color: #ffffff; padding: 30px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1);">
+		<h2 style="color: #00d3f3; margin-top: 0; margin-bottom: 20px; font-size: 24px;">You have been invited</h2>
+		<p>You have been invited to help manage the website of %s. Click the button below to choose a password and create your account.</p>
+		<p style="margin: 30px 0;"><a href="%s" style="background-color: #00d3f3; color: #ffffff; padding: 12px 24px; border-radius: 4px; text-decoration: none;">Accept invitation</a></p>
+		<p style="font-size: 12px; color: #999;">This invitation is valid until %s. If you did not expect it, you can ignore this email.</p>
+	</div>
+</body>
+</html>`, html.EscapeString(is.organization), html.EscapeString(link), expiresAt.Format("02.01.2006 15:04"))
+}
+
+// lock returns a query that loads an invitation and locks it for the transaction
+func (is *InvitationService) lock(tx *gorm.DB, query string, args ...interface{}) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(query, args...)
+}
+
+// invitationSiteScope limits a query to invitations to the site in the
+// context; invitations without sites are to the default site. Invitations are
+// not a tenant table, as one may invite to several sites and is accepted by
+// its token on any host.
+func invitationSiteScope(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		siteID, ok := tenancy.SiteFromContext(ctx)
+		switch {
+		case !ok:
+			db.AddError(tenancy.ErrNoSite)
+			return db
+		case siteID == tenancy.AllSites:
+			return db
+		}
+
+		site, _ := json.Marshal([]string{siteID})
+		if siteID == config.Get().Site.ID {
+			return db.Where("(sites @> ?::jsonb OR sites = '[]'::jsonb)", string(site))
+		}
+		return db.Where("sites @> ?::jsonb", string(site))
+	}
+}
+
+// notFound maps a missing record to ErrInvitationNotFound
+func (is *InvitationService) notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvitationNotFound
+	}
+	return err
+}
+
+// db returns the database handle bound to the context
+func (is *InvitationService) db(ctx context.Context) (*gorm.DB, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return db.WithContext(ctx), nil
+}
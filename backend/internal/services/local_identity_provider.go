@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"manage/internal/models"
+	"manage/internal/repository"
+)
+
+// localUserIDPrefix marks user IDs issued by the local provider, mirroring Auth0's "auth0|" IDs
+const localUserIDPrefix = "local|"
+
+// minPasswordLength is the shortest password accepted for local accounts
+const minPasswordLength = 12
+
+// LocalIdentityProvider authenticates users against the users table, so login
+// works offline and without an Auth0 tenant
+type LocalIdentityProvider struct {
+	users repository.UserRepository
+	// dummyHash is verified when the email is unknown, so response times do not
+	// reveal which accounts exist
+	dummyHash string
+}
+
+// NewLocalIdentityProvider creates a local identity provider for the users in
+// the repository
+func NewLocalIdentityProvider(users repository.UserRepository) *LocalIdentityProvider {
+	dummyHash, _ := HashPassword("not-a-real-password")
+	return &LocalIdentityProvider{users: users, dummyHash: dummyHash}
+}
+
+// Name identifies the provider
+func (p *LocalIdentityProvider) Name() string {
+	return "local"
+}
+
+// Authenticate verifies the password against the stored argon2id hash
+func (p *LocalIdentityProvider) Authenticate(ctx context.Context, email, password string) (*Identity, error) {
+	user, err := p.findByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		VerifyPassword(password, p.dummyHash)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := VerifyPassword(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := p.users.RecordLogin(ctx, user.ID, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to record login: %w", err)
+	}
+
+	return p.identity(user), nil
+}
+
+// LookupUser returns the identity registered for the email address
+func (p *LocalIdentityProvider) LookupUser(ctx context.Context, email string) (*Identity, error) {
+	user, err := p.findByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return p.identity(user), nil
+}
+
+// ListRoles returns the roles of the user with the given ID
+func (p *LocalIdentityProvider) ListRoles(ctx context.Context, userID string) ([]string, error) {
+	user, err := p.findByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return []string(user.Roles), nil
+}
+
+// ListSites returns the sites the user with the given ID may manage
+func (p *LocalIdentityProvider) ListSites(ctx context.Context, userID string) ([]string, error) {
+	user, err := p.findByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return []string(user.Sites), nil
+}
+
+// CreateUser creates a local account with the given password, roles and sites
+func (p *LocalIdentityProvider) CreateUser(ctx context.Context, email, password string, roles, sites []string) (*Identity, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil, fmt.Errorf("email is required")
+	}
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("%w: it must be at least %d characters long", ErrWeakPassword, minPasswordLength)
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Email:        email,
+		PasswordHash: hash,
+		Roles:        models.StringList(roles),
+		Sites:        models.StringList(sites),
+	}
+	if err := p.users.Create(ctx, &user); errors.Is(err, repository.ErrDuplicate) {
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, email)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return p.identity(&user), nil
+}
+
+// findByEmail loads a user by email, ignoring case
+func (p *LocalIdentityProvider) findByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := p.users.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// findByID loads a user by its "local|<id>" identifier
+func (p *LocalIdentityProvider) findByID(ctx context.Context, userID string) (*models.User, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(userID, localUserIDPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(userID, localUserIDPrefix) {
+		return nil, ErrUserNotFound
+	}
+
+	user, err := p.users.FindByID(ctx, uint(id))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// identity converts a stored user into an Identity
+func (p *LocalIdentityProvider) identity(user *models.User) *Identity {
+	roles := []string(user.Roles)
+	if roles == nil {
+		roles = []string{}
+	}
+	sites := []string(user.Sites)
+	if sites == nil {
+		sites = []string{}
+	}
+	return &Identity{
+		ID:    fmt.Sprintf("%s%d", localUserIDPrefix, user.ID),
+		Email: user.Email,
+		Roles: roles,
+		Sites: sites,
+	}
+}
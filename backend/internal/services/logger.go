@@ -0,0 +1,5 @@
+package services
+
+import "manage/internal/logging"
+
+var logger = logging.For("services")
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLockoutNotFound is returned when clearing a lockout that does not exist
+var ErrLockoutNotFound = errors.New("lockout not found")
+
+// throttlePolicy describes how failed attempts are slowed down and locked out
+type throttlePolicy struct {
+	// freeAttempts is the number of failures allowed before delays start
+	freeAttempts int
+	// maxDelay caps the delay, which doubles with every further failure
+	maxDelay time.Duration
+	// lockoutAfter is the number of failures that triggers a lockout
+	lockoutAfter int
+}
+
+var (
+	accountPolicy = throttlePolicy{freeAttempts: 3, maxDelay: 30 * time.Second, lockoutAfter: 10}
+	// A whole congregation can share one IP, so IPs get a more generous policy
+	ipPolicy = throttlePolicy{freeAttempts: 10, maxDelay: 30 * time.Second, lockoutAfter: 50}
+)
+
+// throttleWindow is how long failures are remembered after the last one
+const throttleWindow = time.Hour
+
+// LoginThrottleService slows down repeated failed logins per account and per
+// client IP, and temporarily locks them out after too many failures
+type LoginThrottleService struct {
+	lockoutDuration time.Duration
+	securityEvents  *SecurityEventService
+}
+
+// NewLoginThrottleService creates a new login throttle service
+func NewLoginThrottleService(securityEvents *SecurityEventService) *LoginThrottleService {
+	return &LoginThrottleService{
+		lockoutDuration: config.Get().Auth.LoginLockoutDuration,
+		securityEvents:  securityEvents,
+	}
+}
+
+// Check returns how long the caller has to wait before the next login attempt
+// for this account and IP is allowed; zero means the attempt may proceed
+func (lts *LoginThrottleService) Check(ctx context.Context, email, ipAddress string) (time.Duration, error) {
+	db, err := lts.db(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var throttles []models.LoginThrottle
+	err = db.Where("(kind = ? AND identifier = ?) OR (kind = ? AND identifier = ?)",
+		models.ThrottleKindAccount, normalizeEmail(email),
+		models.ThrottleKindIP, ipAddress,
+	).Find(&throttles).Error
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if throttle.LockedUntil != nil && throttle.LockedUntil.Sub(now) > wait {
+			wait = throttle.LockedUntil.Sub(now)
+		}
+		if throttle.NextAttemptAt != nil && throttle.NextAttemptAt.Sub(now) > wait {
+			wait = throttle.NextAttemptAt.Sub(now)
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordFailure counts a failed login for the account and the IP
+func (lts *LoginThrottleService) RecordFailure(ctx context.Context, email, ipAddress string) error {
+	if err := lts.recordFailure(ctx, models.ThrottleKindAccount, normalizeEmail(email), ipAddress, accountPolicy); err != nil {
+		return err
+	}
+	return lts.recordFailure(ctx, models.ThrottleKindIP, ipAddress, ipAddress, ipPolicy)
+}
+
+// RecordSuccess forgets the failures of the account. IP failures are kept, so
+// logging into one's own account does not reset an attack from the same IP.
+func (lts *LoginThrottleService) RecordSuccess(ctx context.Context, email string) error {
+	db, err := lts.db(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Where("kind = ? AND identifier = ?", models.ThrottleKindAccount, normalizeEmail(email)).
+		Delete(&models.LoginThrottle{}).Error
+}
+
+// ListLockouts returns the accounts and IPs that are currently locked out
+func (lts *LoginThrottleService) ListLockouts(ctx context.Context) ([]models.LoginThrottle, error) {
+	db, err := lts.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var throttles []models.LoginThrottle
+	err = db.Where("locked_until > ?", time.Now()).Order("locked_until DESC").Find(&throttles).Error
+	if err != nil {
+		return nil, err
+	}
+	return throttles, nil
+}
+
+// ClearLockout removes a lockout and its failure count, recording who cleared it
+func (lts *LoginThrottleService) ClearLockout(ctx context.Context, id uint, actor, ipAddress string) error {
+	db, err := lts.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var throttle models.LoginThrottle
+		err := tx.First(&throttle, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrLockoutNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&throttle).Error; err != nil {
+			return err
+		}
+
+		return lts.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventLockoutClear,
+			Subject:   throttle.Kind + ":" + throttle.Identifier,
+			Actor:     &actor,
+			IPAddress: &ipAddress,
+			Details: models.JSONB{
+				"failures":     throttle.Failures,
+				"locked_until": throttle.LockedUntil,
+			},
+		})
+	})
+}
+
+// recordFailure increments the failure count of one throttle and applies the policy
+func (lts *LoginThrottleService) recordFailure(ctx context.Context, kind, identifier, ipAddress string, policy throttlePolicy) error {
+	db, err := lts.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginThrottle{Kind: kind, Identifier: identifier}).Error
+		if err != nil {
+			return err
+		}
+
+		var throttle models.LoginThrottle
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("kind = ? AND identifier = ?", kind, identifier).
+			First(&throttle).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if throttle.LastFailureAt != nil && now.Sub(*throttle.LastFailureAt) > throttleWindow && !throttle.IsLocked() {
+			throttle.Failures = 0
+		}
+
+		wasLocked := throttle.IsLocked()
+		throttle.Failures++
+		throttle.LastFailureAt = &now
+
+		if delay := policy.delay(throttle.Failures); delay > 0 {
+			next := now.Add(delay)
+			throttle.NextAttemptAt = &next
+		}
+
+		lockedNow := false
+		if throttle.Failures >= policy.lockoutAfter && !wasLocked {
+			lockedUntil := now.Add(lts.lockoutDuration)
+			throttle.LockedUntil = &lockedUntil
+			lockedNow = true
+		}
+
+		if err := tx.Save(&throttle).Error; err != nil {
+			return err
+		}
+
+		if !lockedNow {
+			return nil
+		}
+
+		eventType := models.SecurityEventAccountLocked
+		if kind == models.ThrottleKindIP {
+			eventType = models.SecurityEventIPLocked
+		}
+		return lts.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      eventType,
+			Subject:   kind + ":" + identifier,
+			IPAddress: &ipAddress,
+			Details: models.JSONB{
+				"failures":     throttle.Failures,
+				"locked_until": throttle.LockedUntil,
+			},
+		})
+	})
+}
+
+// delay returns how long to wait after the given number of failures
+func (p throttlePolicy) delay(failures int) time.Duration {
+	extra := failures - p.freeAttempts
+	if extra <= 0 {
+		return 0
+	}
+	if extra > 10 {
+		return p.maxDelay
+	}
+	delay := time.Second << (extra - 1)
+	if delay > p.maxDelay {
+		return p.maxDelay
+	}
+	return delay
+}
+
+// db returns the database handle bound to the context
+func (lts *LoginThrottleService) db(ctx context.Context) (*gorm.DB, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return db.WithContext(ctx), nil
+}
+
+// normalizeEmail lowercases and trims an email address for use as a key
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
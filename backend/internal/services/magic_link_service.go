@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidMagicLink is returned for forged, expired or already used login links
+	ErrInvalidMagicLink = errors.New("invalid magic link")
+	// ErrMagicLinkRateLimited is returned when too many links were requested for an address
+	ErrMagicLinkRateLimited = errors.New("too many magic links requested")
+)
+
+// magicLinkPurpose marks tokens that are only valid as a login link
+const magicLinkPurpose = "magic_link"
+
+// magicLinkWindow is the period over which requests per address are limited
+const magicLinkWindow = time.Hour
+
+// magicLinkLock is the Postgres advisory lock, keyed further by the address,
+// that serializes counting and issuing links so concurrent requests cannot
+// exceed the limit
+const magicLinkLock = 0x6d61676c // "magl"
+
+// magicLinkClaims are the claims of the signed token embedded in a login link
+type magicLinkClaims struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// MagicLinkService issues and redeems single-use login links sent by email
+type MagicLinkService struct {
+	secret       []byte
+	ttl          time.Duration
+	maxPerWindow int64
+	linkURL      string
+	emailService *EmailService
+}
+
+// NewMagicLinkService creates a new magic link service. Links are signed with
+// the given secret and point to MAGIC_LINK_URL with the token as ?token=.
+func NewMagicLinkService(secret []byte, emailService *EmailService) *MagicLinkService {
+	cfg := config.Get().Auth
+	return &MagicLinkService{
+		secret:       secret,
+		ttl:          cfg.MagicLinkTTL,
+		maxPerWindow: int64(cfg.MagicLinkMaxPerHour),
+		linkURL:      cfg.MagicLinkURL,
+		emailService: emailService,
+	}
+}
+
+// Send emails a login link to the user, unless too many links were requested
+// for the address recently
+func (mls *MagicLinkService) Send(ctx context.Context, identity *Identity, ipAddress string) error {
+	if !mls.emailService.IsConfigured() {
+		return fmt.Errorf("SMTP not configured")
+	}
+
+	db, err := mls.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokenID, err := GenerateToken(32)
+	if err != nil {
+		return err
+	}
+
+	email := normalizeEmail(identity.Email)
+	now := time.Now()
+	expiresAt := now.Add(mls.ttl)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", magicLinkLock, email).Error; err != nil {
+			return err
+		}
+
+		var recent int64
+		err := tx.Model(&models.MagicLink{}).
+			Where("LOWER(email) = ? AND created_at > ?", email, now.Add(-magicLinkWindow)).
+			Count(&recent).Error
+		if err != nil {
+			return err
+		}
+		if recent >= mls.maxPerWindow {
+			return ErrMagicLinkRateLimited
+		}
+
+		return tx.Create(&models.MagicLink{
+			UserID:    identity.ID,
+			Email:     identity.Email,
+			TokenHash: HashToken(tokenID),
+			IPAddress: &ipAddress,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, magicLinkClaims{
+		Email:   identity.Email,
+		Purpose: magicLinkPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Subject:   identity.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}).SignedString(mls.secret)
+	if err != nil {
+		return err
+	}
+
+	link := mls.linkURL + "?token=" + url.QueryEscape(token)
+	return mls.emailService.SendEmail(ctx, []string{identity.Email}, "Your login link", mls.emailBody(link))
+}
+
+// Consume validates a login link token and marks it as used. It returns the
+// user ID and email address the link was issued for.
+func (mls *MagicLinkService) Consume(ctx context.Context, token string) (string, string, error) {
+	parsed, err := jwt.ParseWithClaims(token, &magicLinkClaims{}, func(*jwt.Token) (interface{}, error) {
+		return mls.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", "", ErrInvalidMagicLink
+	}
+
+	claims, ok := parsed.Claims.(*magicLinkClaims)
+	if !ok || !parsed.Valid || claims.Purpose != magicLinkPurpose || claims.ID == "" {
+		return "", "", ErrInvalidMagicLink
+	}
+
+	db, err := mls.db(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	result := db.Model(&models.MagicLink{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", HashToken(claims.ID), now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return "", "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", "", ErrInvalidMagicLink
+	}
+
+	return claims.Subject, claims.Email, nil
+}
+
+// emailBody renders the HTML email containing the login link
+func (mls *MagicLinkService) emailBody(link string) string {
+	link = html.EscapeString(link)
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; margin: 0; padding: 20px; background-color: #f9f9f9;">
+	<div style="max-width: 600px; margin: 0 auto; background-color: #ffffff; padding: 30px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1);">
+		<h2 style="color: #00d3f3; margin-top: 0; margin-bottom: 20px; font-size: 24px;">Your login link</h2>
+		<p>Click the button below to log in to the admin area. The link can be used once and expires in %d minutes.</p>
+		<p style="margin: 30px 0;"><a href="%s" style="background-color: #00d3f3; color: #ffffff; padding: 12px 24px; border-radius: 4px; text-decoration: none;">Log in</a></p>
+		<p style="font-size: 12px; color: #999;">If you did not request this link, you can ignore this email.</p>
+	</div>
+</body>
+</html>`, int(mls.ttl.Minutes()), link)
+}
+
+// db returns the database handle bound to the context
+func (mls *MagicLinkService) db(ctx context.Context) (*gorm.DB, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return db.WithContext(ctx), nil
+}
@@ -0,0 +1,534 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrMFANotEnrolled is returned when the user has no confirmed TOTP credential
+	ErrMFANotEnrolled = errors.New("two-factor authentication not enrolled")
+	// ErrMFAAlreadyEnrolled is returned when starting an enrollment while one is confirmed
+	ErrMFAAlreadyEnrolled = errors.New("two-factor authentication already enrolled")
+	// ErrMFAEnrollmentNotStarted is returned when confirming without a pending enrollment
+	ErrMFAEnrollmentNotStarted = errors.New("two-factor enrollment not started")
+	// ErrInvalidMFACode is returned for wrong, expired or replayed codes
+	ErrInvalidMFACode = errors.New("invalid two-factor code")
+	// ErrMFARequired is returned when disabling 2FA that is enforced for the user's roles
+	ErrMFARequired = errors.New("two-factor authentication is required for this user")
+)
+
+// recoveryCodeCount is the number of recovery codes issued at once
+const recoveryCodeCount = 10
+
+// recoveryCodeAlphabet avoids characters that are easily confused when typed
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// MFAService manages TOTP credentials, recovery codes and the roles for which
+// two-factor authentication is enforced
+type MFAService struct {
+	issuer         string
+	key            []byte
+	securityEvents *SecurityEventService
+}
+
+// NewMFAService creates a new MFA service. TOTP secrets are encrypted with a
+// key derived from MFA_ENCRYPTION_KEY, falling back to JWT_SECRET.
+func NewMFAService(securityEvents *SecurityEventService) *MFAService {
+	cfg := config.Get().Auth
+	key := sha256.Sum256([]byte("mfa-secret-encryption:" + cfg.MFAEncryptionKey))
+
+	return &MFAService{
+		issuer:         cfg.MFAIssuer,
+		key:            key[:],
+		securityEvents: securityEvents,
+	}
+}
+
+// IsEnrolled reports whether the user has a confirmed TOTP credential
+func (ms *MFAService) IsEnrolled(ctx context.Context, userID string) (bool, error) {
+	credential, err := ms.credential(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return credential.IsConfirmed(), nil
+}
+
+// IsRequired reports whether any of the roles has two-factor authentication enforced
+func (ms *MFAService) IsRequired(ctx context.Context, roles []string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+
+	db, err := ms.db(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var count int64
+	err = db.Model(&models.MFAEnforcedRole{}).Where("role IN ?", roles).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BeginEnrollment creates a new unconfirmed TOTP secret for the user, replacing
+// any earlier unconfirmed one, and returns it with its provisioning URI
+func (ms *MFAService) BeginEnrollment(ctx context.Context, userID, email string) (string, string, error) {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := ms.seal(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing models.MFACredential
+		err := tx.Where("user_id = ?", userID).First(&existing).Error
+		if err == nil && existing.IsConfirmed() {
+			return ErrMFAAlreadyEnrolled
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		return tx.Save(&models.MFACredential{
+			UserID:          userID,
+			SecretEncrypted: sealed,
+			CreatedAt:       time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, TOTPProvisioningURI(ms.issuer, email, secret), nil
+}
+
+// ConfirmEnrollment activates the pending TOTP secret once the user proves
+// possession with a valid code, and returns a fresh set of recovery codes
+func (ms *MFAService) ConfirmEnrollment(ctx context.Context, userID, code, ipAddress string) ([]string, error) {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var credential models.MFACredential
+		err := tx.Where("user_id = ?", userID).First(&credential).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMFAEnrollmentNotStarted
+		}
+		if err != nil {
+			return err
+		}
+		if credential.IsConfirmed() {
+			return ErrMFAAlreadyEnrolled
+		}
+
+		step, err := ms.verify(&credential, code)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err = tx.Model(&credential).Updates(map[string]interface{}{
+			"confirmed_at":   now,
+			"last_used_step": step,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		codes, err = ms.replaceRecoveryCodes(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		return ms.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventMFAEnabled,
+			Subject:   userID,
+			Actor:     &userID,
+			IPAddress: &ipAddress,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP code of an enrolled user. Each code is accepted only once.
+func (ms *MFAService) Verify(ctx context.Context, userID, code string) error {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		credential, err := ms.lockConfirmed(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		step, err := ms.verify(credential, code)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(credential).Update("last_used_step", step).Error
+	})
+}
+
+// VerifyRecoveryCode consumes one of the user's unused recovery codes
+func (ms *MFAService) VerifyRecoveryCode(ctx context.Context, userID, code, ipAddress string) error {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := ms.lockConfirmed(tx, userID); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.MFARecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, HashToken(normalizeRecoveryCode(code))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+
+		var remaining int64
+		err := tx.Model(&models.MFARecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Count(&remaining).Error
+		if err != nil {
+			return err
+		}
+
+		return ms.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventMFARecovery,
+			Subject:   userID,
+			Actor:     &userID,
+			IPAddress: &ipAddress,
+			Details:   models.JSONB{"remaining": remaining},
+		})
+	})
+}
+
+// RegenerateRecoveryCodes invalidates the user's recovery codes and issues new
+// ones; a current TOTP code is required
+func (ms *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		credential, err := ms.lockConfirmed(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		step, err := ms.verify(credential, code)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(credential).Update("last_used_step", step).Error; err != nil {
+			return err
+		}
+
+		codes, err = ms.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable removes the user's TOTP credential and recovery codes after checking
+// a current code. It is refused while 2FA is enforced for one of the roles.
+func (ms *MFAService) Disable(ctx context.Context, userID string, roles []string, code, ipAddress string) error {
+	required, err := ms.IsRequired(ctx, roles)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+
+	db, err := ms.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		credential, err := ms.lockConfirmed(tx, userID)
+		if err != nil {
+			return err
+		}
+		if _, err := ms.verify(credential, code); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(credential).Error; err != nil {
+			return err
+		}
+
+		return ms.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventMFADisabled,
+			Subject:   userID,
+			Actor:     &userID,
+			IPAddress: &ipAddress,
+		})
+	})
+}
+
+// RecoveryCodesRemaining returns how many unused recovery codes the user has
+func (ms *MFAService) RecoveryCodesRemaining(ctx context.Context, userID string) (int64, error) {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = db.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// EnforcedRoles returns the roles for which two-factor authentication is enforced
+func (ms *MFAService) EnforcedRoles(ctx context.Context) ([]string, error) {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []string{}
+	if err := db.Model(&models.MFAEnforcedRole{}).Order("role").Pluck("role", &roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// SetEnforcedRoles replaces the roles for which two-factor authentication is
+// enforced, recording who changed the policy
+func (ms *MFAService) SetEnforcedRoles(ctx context.Context, roles []string, actor, ipAddress string) error {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	roles = uniqueSorted(roles)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.MFAEnforcedRole{}).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := tx.Create(&models.MFAEnforcedRole{Role: role}).Error; err != nil {
+				return err
+			}
+		}
+
+		return ms.securityEvents.record(tx, &models.SecurityEvent{
+			Type:      models.SecurityEventMFAPolicy,
+			Subject:   "mfa_enforced_roles",
+			Actor:     &actor,
+			IPAddress: &ipAddress,
+			Details:   models.JSONB{"roles": roles},
+		})
+	})
+}
+
+// credential loads the TOTP credential of the user, confirmed or not
+func (ms *MFAService) credential(ctx context.Context, userID string) (*models.MFACredential, error) {
+	db, err := ms.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var credential models.MFACredential
+	if err := db.Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// lockConfirmed loads and locks the confirmed credential of the user inside a transaction
+func (ms *MFAService) lockConfirmed(tx *gorm.DB, userID string) (*models.MFACredential, error) {
+	var credential models.MFACredential
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		First(&credential).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// verify checks a code against the credential and returns the matched time step
+func (ms *MFAService) verify(credential *models.MFACredential, code string) (int64, error) {
+	secret, err := ms.open(credential.SecretEncrypted)
+	if err != nil {
+		return 0, err
+	}
+
+	step, ok := VerifyTOTP(secret, code, time.Now(), credential.LastUsedStep)
+	if !ok {
+		return 0, ErrInvalidMFACode
+	}
+	return step, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores new ones
+func (ms *MFAService) replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		err = tx.Create(&models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: HashToken(normalizeRecoveryCode(code)),
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// seal encrypts a TOTP secret with AES-GCM for storage
+func (ms *MFAService) seal(secret string) (string, error) {
+	gcm, err := ms.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a TOTP secret sealed by seal
+func (ms *MFAService) open(sealed string) (string, error) {
+	gcm, err := ms.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted TOTP secret")
+	}
+
+	secret, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// cipher returns the AES-GCM cipher for TOTP secrets
+func (ms *MFAService) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(ms.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// db returns the database handle bound to the context
+func (ms *MFAService) db(ctx context.Context) (*gorm.DB, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return db.WithContext(ctx), nil
+}
+
+// generateRecoveryCode returns a random code of the form xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+
+	var code strings.Builder
+	for i, v := range b {
+		if i == 5 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(recoveryCodeAlphabet[int(v)%len(recoveryCodeAlphabet)])
+	}
+	return code.String(), nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes in typed recovery codes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// uniqueSorted returns the non-empty values sorted and without duplicates
+func uniqueSorted(values []string) []string {
+	set := map[string]bool{}
+	result := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" && !set[value] {
+			set[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
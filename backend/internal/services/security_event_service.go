@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"manage/internal/config"
+	"manage/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SecurityEventService records and lists entries of the security audit trail
+type SecurityEventService struct{}
+
+// NewSecurityEventService creates a new security event service
+func NewSecurityEventService() *SecurityEventService {
+	return &SecurityEventService{}
+}
+
+// Record stores a security event
+func (ses *SecurityEventService) Record(ctx context.Context, event *models.SecurityEvent) error {
+	db := config.GetDB()
+	if db == nil {
+		return config.ErrDatabaseUnavailable
+	}
+	return ses.record(db.WithContext(ctx), event)
+}
+
+// List returns the newest security events, optionally only those of one type
+func (ses *SecurityEventService) List(ctx context.Context, eventType string, limit int) ([]models.SecurityEvent, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+
+	query := db.WithContext(ctx).Order("created_at DESC").Limit(limit)
+	if eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+
+	var events []models.SecurityEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// record stores a security event using the given handle, e.g. inside a transaction
+func (ses *SecurityEventService) record(db *gorm.DB, event *models.SecurityEvent) error {
+	if event.Details == nil {
+		event.Details = models.JSONB{}
+	}
+	if err := db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record security event: %w", err)
+	}
+	logger.InfoContext(db.Statement.Context, "Security event", "type", event.Type, "id", event.ID)
+	return nil
+}
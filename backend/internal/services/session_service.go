@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is
+	// presented again; the whole session is revoked in that case
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	// ErrSessionRevoked is returned when the session has been revoked or has expired
+	ErrSessionRevoked = errors.New("session revoked")
+	// ErrSessionNotFound is returned when no session with the given ID exists for the user
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// Reasons recorded when a session is revoked
+const (
+	RevokedReasonLogout      = "logout"
+	RevokedReasonUser        = "revoked_by_user"
+	RevokedReasonSignOutAll  = "sign_out_everywhere"
+	RevokedReasonTokenReused = "refresh_token_reused"
+)
+
+// activeSessionCacheTTL bounds how long a session is trusted as active without
+// rechecking the database. Revocations done by this process apply immediately.
+const activeSessionCacheTTL = 15 * time.Second
+
+// maxSessionCacheEntries caps the revocation cache; it is simply cleared when full
+const maxSessionCacheEntries = 10000
+
+// SessionService manages login sessions and their rotating refresh tokens
+type SessionService struct {
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]sessionCacheEntry
+}
+
+type sessionCacheEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+// NewSessionService creates a new session service
+func NewSessionService() *SessionService {
+	return &SessionService{
+		accessTokenTTL:  config.Get().Auth.AccessTokenTTL,
+		refreshTokenTTL: config.Get().Auth.RefreshTokenTTL,
+		cache:           map[string]sessionCacheEntry{},
+	}
+}
+
+// AccessTokenTTL returns the lifetime of access tokens issued for sessions
+func (ss *SessionService) AccessTokenTTL() time.Duration {
+	return ss.accessTokenTTL
+}
+
+// CreateSession starts a new session for the identity and returns its first refresh token
+func (ss *SessionService) CreateSession(ctx context.Context, identity *Identity, ipAddress, userAgent string) (*models.Session, string, error) {
+	db, err := ss.db(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionID, err := GenerateToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         sessionID,
+		UserID:     identity.ID,
+		Email:      identity.Email,
+		IPAddress:  &ipAddress,
+		UserAgent:  &userAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(ss.refreshTokenTTL),
+	}
+
+	var refreshToken string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+		refreshToken, err = ss.issueRefreshToken(tx, &session)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &session, refreshToken, nil
+}
+
+// Refresh exchanges a refresh token for a new one. Each refresh token can be
+// used once; presenting a used token again revokes the session, since it means
+// the token was copied.
+func (ss *SessionService) Refresh(ctx context.Context, refreshToken string) (*models.Session, string, error) {
+	db, err := ss.db(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var stored models.RefreshToken
+	err = db.Where("token_hash = ?", HashToken(refreshToken)).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var session models.Session
+	if err := db.First(&session, "id = ?", stored.SessionID).Error; err != nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if !session.IsActive() {
+		return nil, "", ErrSessionRevoked
+	}
+
+	var newToken string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Mark the token used; if another request got there first this is a reuse
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		if time.Now().After(stored.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		session.LastUsedAt = time.Now()
+		if err := tx.Model(&session).Update("last_used_at", session.LastUsedAt).Error; err != nil {
+			return err
+		}
+
+		newToken, err = ss.issueRefreshToken(tx, &session)
+		return err
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if revokeErr := ss.revoke(db, RevokedReasonTokenReused, "id = ?", session.ID); revokeErr != nil {
+			return nil, "", revokeErr
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &session, newToken, nil
+}
+
+// ListSessions returns the active sessions of the user, newest first
+func (ss *SessionService) ListSessions(ctx context.Context, userID string) ([]models.Session, error) {
+	db, err := ss.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []models.Session
+	err = db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one session of the user
+func (ss *SessionService) RevokeSession(ctx context.Context, userID, sessionID, reason string) error {
+	db, err := ss.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := db.Model(&models.Session{}).Where("id = ? AND user_id = ?", sessionID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSessionNotFound
+	}
+
+	return ss.revoke(db, reason, "id = ? AND user_id = ?", sessionID, userID)
+}
+
+// RevokeAllSessions revokes every session of the user ("sign out everywhere")
+func (ss *SessionService) RevokeAllSessions(ctx context.Context, userID, reason string) error {
+	db, err := ss.db(ctx)
+	if err != nil {
+		return err
+	}
+	return ss.revoke(db, reason, "user_id = ?", userID)
+}
+
+// IsRevoked reports whether the session has been revoked or has expired. It is
+// checked on every authenticated request, so results are cached briefly.
+func (ss *SessionService) IsRevoked(sessionID string) (bool, error) {
+	ss.mu.Lock()
+	entry, ok := ss.cache[sessionID]
+	ss.mu.Unlock()
+	if ok && (entry.revoked || time.Since(entry.checkedAt) < activeSessionCacheTTL) {
+		return entry.revoked, nil
+	}
+
+	db, err := ss.db(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	var session models.Session
+	err = db.Select("id", "revoked_at", "expires_at").First(&session, "id = ?", sessionID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	revoked := errors.Is(err, gorm.ErrRecordNotFound) || !session.IsActive()
+
+	ss.mu.Lock()
+	if len(ss.cache) >= maxSessionCacheEntries {
+		ss.cache = map[string]sessionCacheEntry{}
+	}
+	ss.cache[sessionID] = sessionCacheEntry{revoked: revoked, checkedAt: time.Now()}
+	ss.mu.Unlock()
+
+	return revoked, nil
+}
+
+// revoke marks the active sessions matching the condition as revoked and updates the cache
+func (ss *SessionService) revoke(db *gorm.DB, reason string, condition string, args ...interface{}) error {
+	var ids []string
+	err := db.Model(&models.Session{}).
+		Where(condition, args...).
+		Where("revoked_at IS NULL").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err = db.Model(&models.Session{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	ss.mu.Lock()
+	for _, id := range ids {
+		ss.cache[id] = sessionCacheEntry{revoked: true, checkedAt: time.Now()}
+	}
+	ss.mu.Unlock()
+
+	return nil
+}
+
+// issueRefreshToken creates a new refresh token for the session
+func (ss *SessionService) issueRefreshToken(tx *gorm.DB, session *models.Session) (string, error) {
+	token, err := GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	record := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: HashToken(token),
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// db returns the database handle bound to the context
+func (ss *SessionService) db(ctx context.Context) (*gorm.DB, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return db.WithContext(ctx), nil
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+	"manage/internal/tenancy"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSiteNotFound is returned when no site exists for the ID
+	ErrSiteNotFound = errors.New("site not found")
+	// ErrSiteExists is returned when creating a site whose ID is taken
+	ErrSiteExists = errors.New("site already exists")
+	// ErrInvalidSiteID is returned for IDs that are not lowercase slugs
+	ErrInvalidSiteID = errors.New("site ID must consist of lowercase letters, digits and dashes")
+	// ErrHostTaken is returned when a host name already belongs to another site
+	ErrHostTaken = errors.New("host is already assigned to another site")
+)
+
+// SiteService manages the sites sharing this deployment and resolves the site
+// of a request. Sites change rarely, so they are cached for SITE_CACHE_TTL.
+type SiteService struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sites    []models.Site
+	loadedAt time.Time
+}
+
+// NewSiteService creates a new site service
+func NewSiteService() *SiteService {
+	return &SiteService{
+		ttl: config.Get().Site.CacheTTL,
+	}
+}
+
+// List returns all sites ordered by ID
+func (ss *SiteService) List(ctx context.Context) ([]models.Site, error) {
+	db, err := ss.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sites []models.Site
+	if err := db.Order("id ASC").Find(&sites).Error; err != nil {
+		return nil, err
+	}
+	return sites, nil
+}
+
+// Create adds a site
+func (ss *SiteService) Create(ctx context.Context, id, name, siteURL string, hosts []string) (*models.Site, error) {
+	db, err := ss.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !tenancy.ValidSiteID(id) {
+		return nil, ErrInvalidSiteID
+	}
+
+	site := &models.Site{
+		ID:    id,
+		Name:  strings.TrimSpace(name),
+		Hosts: models.StringList(normalizeHosts(hosts)),
+		URL:   normalizeSiteURL(siteURL),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&models.Site{}).Where("id = ?", id).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrSiteExists
+		}
+		if err := ss.checkHosts(tx, id, site.Hosts); err != nil {
+			return err
+		}
+		return tx.Create(site).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ss.invalidate()
+	return site, nil
+}
+
+// Update changes the name, website and host names of a site
+func (ss *SiteService) Update(ctx context.Context, id, name, siteURL string, hosts []string) (*models.Site, error) {
+	db, err := ss.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var site models.Site
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&site, "id = ?", id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSiteNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		site.Name = strings.TrimSpace(name)
+		site.URL = normalizeSiteURL(siteURL)
+		site.Hosts = models.StringList(normalizeHosts(hosts))
+		if err := ss.checkHosts(tx, id, site.Hosts); err != nil {
+			return err
+		}
+		return tx.Save(&site).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ss.invalidate()
+	return &site, nil
+}
+
+// SiteForHost implements middleware.SiteResolver. It returns the site a host
+// name is assigned to; ok is false for unknown hosts.
+func (ss *SiteService) SiteForHost(ctx context.Context, host string) (string, bool, error) {
+	sites, err := ss.cached(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	host = normalizeHost(host)
+	for _, site := range sites {
+		for _, siteHost := range site.Hosts {
+			if siteHost == host {
+				return site.ID, true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// SiteExists implements middleware.SiteResolver
+func (ss *SiteService) SiteExists(ctx context.Context, siteID string) (bool, error) {
+	sites, err := ss.cached(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, site := range sites {
+		if site.ID == siteID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Site returns the site with the given ID
+func (ss *SiteService) Site(ctx context.Context, siteID string) (*models.Site, error) {
+	sites, err := ss.cached(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, site := range sites {
+		if site.ID == siteID {
+			return &site, nil
+		}
+	}
+	return nil, ErrSiteNotFound
+}
+
+// PublicURL returns the website of a site: its URL, SITE_URL for the default
+// site, or else https:// and its first host
+func (ss *SiteService) PublicURL(site *models.Site) string {
+	switch {
+	case site.URL != "":
+		return site.URL
+	case site.ID == config.Get().Site.ID || len(site.Hosts) == 0:
+		return config.Get().Site.URL
+	default:
+		return "https://" + site.Hosts[0]
+	}
+}
+
+// cached returns all sites, reloading them when the cache has expired
+func (ss *SiteService) cached(ctx context.Context) ([]models.Site, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.sites != nil && time.Since(ss.loadedAt) < ss.ttl {
+		return ss.sites, nil
+	}
+
+	sites, err := ss.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ss.sites = sites
+	ss.loadedAt = time.Now()
+	return sites, nil
+}
+
+// invalidate makes the next lookup reload the sites
+func (ss *SiteService) invalidate() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.sites = nil
+}
+
+// checkHosts fails with ErrHostTaken when another site already uses one of the hosts
+func (ss *SiteService) checkHosts(tx *gorm.DB, siteID string, hosts []string) error {
+	var others []models.Site
+	if err := tx.Where("id <> ?", siteID).Find(&others).Error; err != nil {
+		return err
+	}
+
+	for _, other := range others {
+		for _, host := range other.Hosts {
+			for _, wanted := range hosts {
+				if host == wanted {
+					return fmt.Errorf("%w: %s", ErrHostTaken, host)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// db returns the database handle bound to the context
+func (ss *SiteService) db(ctx context.Context) (*gorm.DB, error) {
+	db := config.GetDB()
+	if db == nil {
+		return nil, config.ErrDatabaseUnavailable
+	}
+	return db.WithContext(ctx), nil
+}
+
+// normalizeHosts lowercases host names, strips ports and drops duplicates
+func normalizeHosts(hosts []string) []string {
+	result := []string{}
+	for _, host := range hosts {
+		if host = normalizeHost(host); host != "" {
+			result = append(result, host)
+		}
+	}
+	return uniqueSorted(result)
+}
+
+// normalizeSiteURL trims spaces and the trailing slash of a website URL
+func normalizeSiteURL(siteURL string) string {
+	return strings.TrimRight(strings.TrimSpace(siteURL), "/")
+}
+
+// normalizeHost lowercases a host name and strips the port
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+)
+
+// eventStatusURLs maps our stored event statuses to schema.org EventStatusType values
+var eventStatusURLs = map[string]string{
+	models.EventStatusScheduled:   "https://schema.org/EventScheduled",
+	models.EventStatusCancelled:   "https://schema.org/EventCancelled",
+	models.EventStatusPostponed:   "https://schema.org/EventPostponed",
+	models.EventStatusRescheduled: "https://schema.org/EventRescheduled",
+	models.EventStatusMovedOnline: "https://schema.org/EventMovedOnline",
+}
+
+// StructuredDataService builds schema.org JSON-LD and Open Graph metadata for
+// events, naming and linking the site each event belongs to
+type StructuredDataService struct {
+	sites *SiteService
+}
+
+// NewStructuredDataService creates a new structured data service that looks
+// up the sites of events in the given service
+func NewStructuredDataService(sites *SiteService) *StructuredDataService {
+	return &StructuredDataService{
+		sites: sites,
+	}
+}
+
+// eventSite is the website and organization an event is published by
+type eventSite struct {
+	url  string
+	name string
+}
+
+// EventMetadata bundles everything a page or prerenderer needs to describe an event
+type EventMetadata struct {
+	JSONLD    map[string]interface{} `json:"json_ld"`
+	OpenGraph map[string]string      `json:"open_graph"`
+	Head      string                 `json:"head"`
+}
+
+// headTemplate renders the JSON-LD script tag and Open Graph meta tags for injection into <head>
+var headTemplate = template.Must(template.New("head").Parse(
+	`<script type="application/ld+json">{{.JSONLD}}</script>
+{{range .OpenGraph}}<meta property="{{.Property}}" content="{{.Content}}">
+{{end}}`))
+
+// ogOrder keeps the Open Graph tags in a stable order in the rendered head
+var ogOrder = []string{"og:type", "og:site_name", "og:title", "og:description", "og:url", "og:image"}
+
+// site resolves the website and name of the site an event belongs to
+func (sds *StructuredDataService) site(ctx context.Context, event models.Event) (eventSite, error) {
+	site, err := sds.sites.Site(ctx, event.SiteID)
+	if err != nil {
+		return eventSite{}, fmt.Errorf("failed to look up site %q: %w", event.SiteID, err)
+	}
+
+	name := site.Name
+	if name == "" {
+		name = config.Get().Site.OrganizationName
+	}
+	return eventSite{url: sds.sites.PublicURL(site), name: name}, nil
+}
+
+// eventURL returns the public URL of an event on its site
+func (sds *StructuredDataService) eventURL(site eventSite, event models.Event) string {
+	return fmt.Sprintf("%s/events#event-%d", site.url, event.ID)
+}
+
+// eventJSONLD builds the schema.org Event object for an event
+func (sds *StructuredDataService) eventJSONLD(site eventSite, event models.Event) map[string]interface{} {
+	status, ok := eventStatusURLs[event.Status]
+	if !ok {
+		status = eventStatusURLs[models.EventStatusScheduled]
+	}
+
+	attendanceMode := "https://schema.org/OfflineEventAttendanceMode"
+	if event.Status == models.EventStatusMovedOnline {
+		attendanceMode = "https://schema.org/OnlineEventAttendanceMode"
+	}
+
+	address := map[string]interface{}{
+		"@type": "PostalAddress",
+	}
+	if event.StreetAddress != nil && *event.StreetAddress != "" {
+		address["streetAddress"] = *event.StreetAddress
+	}
+	if event.City != nil && *event.City != "" {
+		address["addressLocality"] = *event.City
+	}
+	if event.PostalCode != nil && *event.PostalCode != "" {
+		address["postalCode"] = *event.PostalCode
+	}
+	if event.Country != nil && *event.Country != "" {
+		address["addressCountry"] = *event.Country
+	}
+
+	jsonLD := map[string]interface{}{
+		"@context":            "https://schema.org",
+		"@type":               "Event",
+		"name":                event.Title,
+		"description":         event.Description,
+		"startDate":           event.StartTime.Format(time.RFC3339),
+		"eventStatus":         status,
+		"eventAttendanceMode": attendanceMode,
+		"url":                 sds.eventURL(site, event),
+		"location": map[string]interface{}{
+			"@type":   "Place",
+			"name":    event.LocationName,
+			"address": address,
+		},
+		"organizer": map[string]interface{}{
+			"@type": "Organization",
+			"name":  site.name,
+			"url":   site.url,
+		},
+	}
+
+	if event.EndTime != nil {
+		jsonLD["endDate"] = event.EndTime.Format(time.RFC3339)
+	}
+	if image := sds.imageURL(site, event); image != "" {
+		jsonLD["image"] = []string{image}
+	}
+
+	return jsonLD
+}
+
+// eventOpenGraph builds the Open Graph tags used for link previews of an event
+func (sds *StructuredDataService) eventOpenGraph(site eventSite, event models.Event) map[string]string {
+	tags := map[string]string{
+		"og:type":      "website",
+		"og:site_name": site.name,
+		"og:title":     event.Title,
+		"og:url":       sds.eventURL(site, event),
+	}
+	if event.Description != "" {
+		tags["og:description"] = event.Description
+	}
+	if image := sds.imageURL(site, event); image != "" {
+		tags["og:image"] = image
+	}
+	return tags
+}
+
+// EventMetadata builds the JSON-LD, Open Graph tags and rendered head snippet for an event
+func (sds *StructuredDataService) EventMetadata(ctx context.Context, event models.Event) (*EventMetadata, error) {
+	site, err := sds.site(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonLD := sds.eventJSONLD(site, event)
+	openGraph := sds.eventOpenGraph(site, event)
+
+	head, err := sds.renderHead(jsonLD, openGraph)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventMetadata{
+		JSONLD:    jsonLD,
+		OpenGraph: openGraph,
+		Head:      head,
+	}, nil
+}
+
+// renderHead renders the <head> snippet with the JSON-LD script and Open Graph meta tags
+func (sds *StructuredDataService) renderHead(jsonLD map[string]interface{}, openGraph map[string]string) (string, error) {
+	jsonData, err := json.Marshal(jsonLD)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON-LD: %w", err)
+	}
+
+	type metaTag struct {
+		Property string
+		Content  string
+	}
+	var tags []metaTag
+	for _, property := range ogOrder {
+		if content, ok := openGraph[property]; ok {
+			tags = append(tags, metaTag{Property: property, Content: content})
+		}
+	}
+
+	var buf bytes.Buffer
+	err = headTemplate.Execute(&buf, map[string]interface{}{
+		// json.Marshal escapes <, > and & so the payload cannot close the script tag
+		"JSONLD":    template.JS(jsonData),
+		"OpenGraph": tags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render head: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// imageURL returns the absolute image URL of an event, resolving site-relative paths
+func (sds *StructuredDataService) imageURL(site eventSite, event models.Event) string {
+	if event.ImageURL == nil || *event.ImageURL == "" {
+		return ""
+	}
+	if strings.HasPrefix(*event.ImageURL, "/") {
+		return site.url + *event.ImageURL
+	}
+	return *event.ImageURL
+}
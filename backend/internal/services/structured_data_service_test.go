@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"manage/internal/config"
+	"manage/internal/models"
+)
+
+// newTestStructuredDataService returns a service whose sites are preloaded,
+// so no database is needed
+func newTestStructuredDataService(sites ...models.Site) *StructuredDataService {
+	siteService := &SiteService{ttl: time.Hour, sites: sites, loadedAt: time.Now()}
+	return NewStructuredDataService(siteService)
+}
+
+func TestEventMetadataNamesTheSiteOfTheEvent(t *testing.T) {
+	defaultSite := config.Get().Site
+	sds := newTestStructuredDataService(
+		models.Site{ID: defaultSite.ID, Name: "Calvary Chapel Lippstadt"},
+		models.Site{ID: "cc-soest", Name: "Calvary Chapel Soest", Hosts: models.StringList{"api.cc-soest.de"}, URL: "https://cc-soest.de"},
+		models.Site{ID: "cc-unna", Name: "Calvary Chapel Unna", Hosts: models.StringList{"cc-unna.de"}},
+	)
+
+	image := "/images/worship.jpg"
+	tests := []struct {
+		siteID string
+		name   string
+		url    string
+	}{
+		{defaultSite.ID, "Calvary Chapel Lippstadt", defaultSite.URL},
+		{"cc-soest", "Calvary Chapel Soest", "https://cc-soest.de"},
+		{"cc-unna", "Calvary Chapel Unna", "https://cc-unna.de"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.siteID, func(t *testing.T) {
+			event := models.Event{ID: 7, SiteID: tt.siteID, Title: "Worship night", StartTime: time.Now(), ImageURL: &image}
+
+			metadata, err := sds.EventMetadata(context.Background(), event)
+			if err != nil {
+				t.Fatalf("EventMetadata: %v", err)
+			}
+
+			organizer := metadata.JSONLD["organizer"].(map[string]interface{})
+			if organizer["name"] != tt.name || organizer["url"] != tt.url {
+				t.Errorf("organizer = %v, want %s at %s", organizer, tt.name, tt.url)
+			}
+			if got, want := metadata.JSONLD["url"], tt.url+"/events#event-7"; got != want {
+				t.Errorf("url = %v, want %s", got, want)
+			}
+			if got := metadata.OpenGraph["og:site_name"]; got != tt.name {
+				t.Errorf("og:site_name = %q, want %q", got, tt.name)
+			}
+			if got, want := metadata.OpenGraph["og:image"], tt.url+image; got != want {
+				t.Errorf("og:image = %q, want %q", got, want)
+			}
+			if !strings.Contains(metadata.Head, tt.url+"/events#event-7") {
+				t.Errorf("head does not link the event on its site: %s", metadata.Head)
+			}
+		})
+	}
+}
+
+func TestEventMetadataFailsForUnknownSites(t *testing.T) {
+	sds := newTestStructuredDataService(models.Site{ID: "cc-soest", Name: "Calvary Chapel Soest"})
+
+	_, err := sds.EventMetadata(context.Background(), models.Event{SiteID: "cc-unna", StartTime: time.Now()})
+	if !errors.Is(err, ErrSiteNotFound) {
+		t.Errorf("EventMetadata returned %v, want ErrSiteNotFound", err)
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890"
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// TestTOTPCodeRFC6238 checks the SHA-1 test vectors of RFC 6238 Appendix B.
+// The RFC lists eight digits; our six-digit codes are their last six.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d): %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestTOTPCodeAcceptsLowercaseSecret(t *testing.T) {
+	code, err := TOTPCode(strings.ToLower(rfc6238Secret), time.Unix(59, 0))
+	if err != nil || code != "287082" {
+		t.Errorf("TOTPCode with a lowercase secret = %q, %v; want 287082", code, err)
+	}
+}
+
+func TestTOTPCodeRejectsInvalidSecret(t *testing.T) {
+	if _, err := TOTPCode("not base32!", time.Now()); err == nil {
+		t.Error("TOTPCode accepted a secret that is not base32")
+	}
+}
+
+func TestVerifyTOTPWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		valid  bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -totpPeriod * time.Second, true},
+		{"next step", totpPeriod * time.Second, true},
+		{"two steps ago", -2 * totpPeriod * time.Second, false},
+		{"two steps ahead", 2 * totpPeriod * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codeTime := now.Add(tt.offset)
+			code, err := TOTPCode(rfc6238Secret, codeTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			step, ok := VerifyTOTP(rfc6238Secret, code, now, 0)
+			if ok != tt.valid {
+				t.Fatalf("VerifyTOTP = %v, want %v", ok, tt.valid)
+			}
+			if ok && step != codeTime.Unix()/totpPeriod {
+				t.Errorf("matched step %d, want %d (current %d)", step, codeTime.Unix()/totpPeriod, current)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPRejectsReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := TOTPCode(rfc6238Secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := VerifyTOTP(rfc6238Secret, code, now, 0)
+	if !ok {
+		t.Fatal("first use of the code was rejected")
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, code, now, step); ok {
+		t.Error("code was accepted again after its step was stored as last_used_step")
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, code, now.Add(totpPeriod*time.Second), step); ok {
+		t.Error("code was accepted again in the next step")
+	}
+
+	// A code of an earlier step stays rejected once a later one was used
+	earlier, err := TOTPCode(rfc6238Secret, now.Add(-totpPeriod*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, earlier, now, step); ok {
+		t.Error("code of a step before last_used_step was accepted")
+	}
+
+	next, err := TOTPCode(rfc6238Secret, now.Add(totpPeriod*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, next, now, step); !ok {
+		t.Error("code of the step after last_used_step was rejected")
+	}
+}
+
+func TestVerifyTOTPRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef", "94287082"} {
+		if _, ok := VerifyTOTP(rfc6238Secret, code, now, 0); ok {
+			t.Errorf("VerifyTOTP accepted %q", code)
+		}
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, " 287082 ", now, 0); !ok {
+		t.Error("VerifyTOTP rejected a code surrounded by spaces")
+	}
+}
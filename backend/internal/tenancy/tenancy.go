@@ -0,0 +1,130 @@
+// Package tenancy scopes tenant data to the site (congregation) a request
+// belongs to. Several sites share one deployment; rows of tenant tables carry
+// a site_id, and GORM callbacks restrict every query on them to the site
+// stored in the statement's context.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AllSites in a context lifts the site scope, for cross-site views of
+// super-admins and for background jobs
+const AllSites = "*"
+
+// siteColumn holds the site of a row in tenant tables
+const siteColumn = "site_id"
+
+// ErrNoSite is returned when tenant data is accessed without a site in the
+// context, or created without choosing a single site
+var ErrNoSite = errors.New("no site selected for tenant data")
+
+// ErrCrossSiteUpsert is returned for upserts on tenant tables
+var ErrCrossSiteUpsert = errors.New("upserts are not supported on tenant data")
+
+// siteIDPattern matches valid site IDs such as "cc-lippstadt"
+var siteIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ValidSiteID reports whether id may name a site: lowercase letters, digits
+// and dashes, starting with a letter or digit
+func ValidSiteID(id string) bool {
+	return siteIDPattern.MatchString(id)
+}
+
+type contextKey struct{}
+
+// WithSite returns a context whose tenant queries are limited to the site
+func WithSite(ctx context.Context, siteID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, siteID)
+}
+
+// WithAllSites returns a context whose tenant queries see every site
+func WithAllSites(ctx context.Context) context.Context {
+	return WithSite(ctx, AllSites)
+}
+
+// SiteFromContext returns the site stored in the context, or AllSites
+func SiteFromContext(ctx context.Context) (string, bool) {
+	siteID, ok := ctx.Value(contextKey{}).(string)
+	return siteID, ok && siteID != ""
+}
+
+// Register installs the callbacks that scope the given tables by site.
+// Queries, updates and deletes get a site_id condition, and created rows get
+// the site of the context. Using a tenant table without a site in the context
+// fails with ErrNoSite, so a forgotten WithContext cannot leak other sites' data.
+func Register(db *gorm.DB, tables ...string) error {
+	scoped := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		scoped[table] = true
+	}
+
+	condition := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || !scoped[tx.Statement.Schema.Table] {
+			return
+		}
+		siteID, ok := SiteFromContext(tx.Statement.Context)
+		if !ok {
+			tx.AddError(ErrNoSite)
+			return
+		}
+		if siteID == AllSites {
+			return
+		}
+		tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: siteColumn}, Value: siteID},
+		}})
+	}
+
+	assign := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || !scoped[tx.Statement.Schema.Table] {
+			return
+		}
+		siteID, ok := SiteFromContext(tx.Statement.Context)
+		if !ok || siteID == AllSites {
+			tx.AddError(ErrNoSite)
+			return
+		}
+		// An upsert could take over a row of another site with the same key,
+		// e.g. when Save finds nothing to update in the current site
+		if _, ok := tx.Statement.Clauses["ON CONFLICT"]; ok {
+			tx.AddError(ErrCrossSiteUpsert)
+			return
+		}
+		field := tx.Statement.Schema.LookUpField(siteColumn)
+		if field == nil {
+			return
+		}
+
+		ctx := tx.Statement.Context
+		value := tx.Statement.ReflectValue
+		switch value.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < value.Len(); i++ {
+				if err := field.Set(ctx, reflect.Indirect(value.Index(i)), siteID); err != nil {
+					tx.AddError(err)
+					return
+				}
+			}
+		case reflect.Struct:
+			if err := field.Set(ctx, value, siteID); err != nil {
+				tx.AddError(err)
+			}
+		}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Query().Before("gorm:query").Register("tenancy:query", condition),
+		callbacks.Row().Before("gorm:row").Register("tenancy:row", condition),
+		callbacks.Update().Before("gorm:update").Register("tenancy:update", condition),
+		callbacks.Delete().Before("gorm:delete").Register("tenancy:delete", condition),
+		callbacks.Create().Before("gorm:create").Register("tenancy:create", assign),
+	)
+}
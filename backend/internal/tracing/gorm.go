@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"errors"
+	"strings"
+
+	"manage/internal/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Keys storing the span of a statement and its operation between the callbacks
+const (
+	gormSpanKey      = "tracing:span"
+	gormOperationKey = "tracing:operation"
+)
+
+// RegisterGorm records a span for every statement run through db. Spans
+// carry the SQL with placeholders, never the values bound to it.
+func RegisterGorm(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Query().Before("gorm:query").Register("tracing:before_query", startStatement("SELECT")),
+		callbacks.Query().After("gorm:after_query").Register("tracing:after_query", endStatement),
+		callbacks.Row().Before("gorm:row").Register("tracing:before_row", startStatement("SELECT")),
+		callbacks.Row().After("gorm:row").Register("tracing:after_row", endStatement),
+		callbacks.Raw().Before("gorm:raw").Register("tracing:before_raw", startStatement("")),
+		callbacks.Raw().After("gorm:raw").Register("tracing:after_raw", endStatement),
+		callbacks.Create().Before("gorm:begin_transaction").Register("tracing:before_create", startStatement("INSERT")),
+		callbacks.Create().After("gorm:commit_or_rollback_transaction").Register("tracing:after_create", endStatement),
+		callbacks.Update().Before("gorm:begin_transaction").Register("tracing:before_update", startStatement("UPDATE")),
+		callbacks.Update().After("gorm:commit_or_rollback_transaction").Register("tracing:after_update", endStatement),
+		callbacks.Delete().Before("gorm:begin_transaction").Register("tracing:before_delete", startStatement("DELETE")),
+		callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register("tracing:after_delete", endStatement),
+	)
+}
+
+// startStatement starts the span of a statement as a child of the span in the
+// statement's context. Raw statements, whose operation is empty, are named
+// after the first keyword of their SQL once it is known.
+func startStatement(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx, span := Tracer().Start(tx.Statement.Context, "db "+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL),
+		)
+		if operation != "" {
+			span.SetAttributes(semconv.DBOperationName(operation))
+		}
+		tx.Statement.Context = ctx
+		tx.InstanceSet(gormSpanKey, span)
+		if operation != "" {
+			tx.InstanceSet(gormOperationKey, operation)
+		}
+	}
+}
+
+// endStatement ends the span with the SQL, the affected rows and the error
+func endStatement(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	sql := tx.Statement.SQL.String()
+	if _, named := tx.InstanceGet(gormOperationKey); !named {
+		operation, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+		operation = strings.ToUpper(operation)
+		span.SetName("db " + operation)
+		span.SetAttributes(semconv.DBOperationName(operation))
+	}
+	if tx.Statement.Table != "" {
+		span.SetAttributes(semconv.DBCollectionName(tx.Statement.Table))
+	}
+	span.SetAttributes(
+		semconv.DBQueryText(sql),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		// Errors of constraints quote the offending values
+		span.SetStatus(codes.Error, logging.RedactString(tx.Error.Error()))
+	}
+}
@@ -1,25 +1,90 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"os"
+	"time"
 
+	"manage/internal/apidocs"
+	"manage/internal/commands"
 	"manage/internal/config"
+	"manage/internal/logging"
+	"manage/internal/metrics"
 	"manage/internal/middleware"
+	"manage/internal/migrate"
 	"manage/internal/routes"
+	"manage/internal/server"
+	"manage/internal/tracing"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+var logger = logging.For("main")
+
 func main() {
-	// Initialize database
-	config.InitDatabase()
+	// Run a CLI subcommand (e.g. "create-admin") instead of the server
+	if len(os.Args) > 1 {
+		if err := commands.Run(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Refuse to start with an invalid or, in production, insecure configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	err = logging.Setup(logging.Options{Format: cfg.Log.Format, Level: cfg.Log.Level, Levels: cfg.Log.Levels})
+	if err != nil {
+		fatal("Invalid log configuration", err)
+	}
+	logger.Info("Configuration loaded", "profile", cfg.Env, "config", cfg)
+
+	// Trace requests, queries and calls to Auth0 and the SMTP server
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+		Environment: cfg.Env,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
+	// Refuse to start with an invalid role configuration
+	if err := middleware.ValidateAuthConfig(); err != nil {
+		fatal("Invalid auth configuration", err)
+	}
+
+	// Refuse to serve on an outdated schema unless DB_SCHEMA_CHECK says otherwise
+	config.OnDatabaseConnect(func(ctx context.Context, db *gorm.DB) error {
+		return migrate.CheckOnStartup(ctx, db, cfg.Database.SchemaCheck)
+	})
+
+	// Initialize database; while it is unreachable requests get a 503 and the
+	// monitor keeps reconnecting
+	if err := config.InitDatabase(); err != nil {
+		fatal("Failed to initialize database", err)
+	}
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	go config.MonitorDatabase(monitorCtx)
+	metrics.RegisterDatabase(config.SQLDB(), config.DatabaseAvailable)
 
 	// Initialize Gin router
 	r := gin.New()
 
 	// Add middleware
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Tracing())
 	r.Use(middleware.Logger())
-	r.Use(gin.Recovery())
+	r.Use(middleware.Metrics())
+	r.Use(middleware.Errors())
+	r.Use(middleware.Recovery())
 
 	// Configure CORS
 	config.SetupCORS(r)
@@ -27,13 +92,41 @@ func main() {
 	// Setup routes
 	routes.SetupRoutes(r)
 
-	// Start server (always on port 8080 inside container)
-	port := "8080"
+	// Serve the metrics on the internal listener or behind their token
+	var internal []server.Listener
+	if handler := routes.SetupMetrics(r, cfg.Metrics); handler != nil {
+		internal = append(internal, server.Listener{Name: "metrics", Addr: cfg.Metrics.Addr, Handler: handler})
+	} else if cfg.Metrics.Token == "" {
+		logger.Info("Metrics are not served; set METRICS_ADDR or METRICS_TOKEN to enable /metrics")
+	}
+
+	// "./main openapi check" fails on these; the server still starts
+	if undocumented, _ := apidocs.Coverage(r.Routes()); len(undocumented) > 0 {
+		logger.Warn("Routes missing from the OpenAPI document", "routes", undocumented)
+	}
+
+	// Serve until SIGTERM, then drain requests and background tasks such as
+	// notification emails
+	logger.Info("Server starting", "port", cfg.Server.Port)
 
-	log.Printf("🚀 Server starting on port %s", port)
-	log.Printf("📚 API Documentation available at http://0.0.0.0:%s/api/health", port)
-	
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	err = server.Run(cfg.Server, r, internal...)
+	stopMonitor()
+	if closeErr := config.CloseDatabase(); closeErr != nil {
+		logger.Error("Failed to close database", "error", closeErr)
+	}
+	// Export the spans of the last requests
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	if flushErr := shutdownTracing(flushCtx); flushErr != nil {
+		logger.Error("Failed to flush traces", "error", flushErr)
+	}
+	cancelFlush()
+	if err != nil {
+		fatal("Server stopped with errors", err)
 	}
 }
+
+// fatal logs the error and exits
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
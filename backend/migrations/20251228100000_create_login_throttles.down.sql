@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_security_events_type;
+DROP INDEX IF EXISTS idx_security_events_created_at;
+DROP TABLE IF EXISTS security_events;
+DROP INDEX IF EXISTS idx_login_throttles_kind_identifier;
+DROP TABLE IF EXISTS login_throttles;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_magic_links_email_created_at;
+DROP INDEX IF EXISTS idx_magic_links_token_hash;
+DROP TABLE IF EXISTS magic_links;
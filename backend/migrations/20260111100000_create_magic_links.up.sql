@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS magic_links (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    ip_address TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_magic_links_token_hash ON magic_links (token_hash);
+CREATE INDEX IF NOT EXISTS idx_magic_links_email_created_at ON magic_links (LOWER(email), created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_invitations_email;
+DROP INDEX IF EXISTS idx_invitations_token_hash;
+DROP TABLE IF EXISTS invitations;
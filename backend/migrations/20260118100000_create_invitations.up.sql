@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    roles JSONB NOT NULL DEFAULT '[]'::jsonb,
+    sites JSONB NOT NULL DEFAULT '[]'::jsonb,
+    token_hash TEXT NOT NULL,
+    invited_by TEXT NOT NULL,
+    user_id TEXT,
+    send_count INTEGER NOT NULL DEFAULT 0,
+    last_sent_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_token_hash ON invitations (token_hash);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (LOWER(email));
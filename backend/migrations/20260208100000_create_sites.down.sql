@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_api_keys_site_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS site_id;
+DROP INDEX IF EXISTS idx_events_site_id;
+ALTER TABLE events DROP COLUMN IF EXISTS site_id;
+DROP INDEX IF EXISTS idx_contact_requests_site_id;
+ALTER TABLE contact_requests DROP COLUMN IF EXISTS site_id;
+DROP TABLE IF EXISTS sites;
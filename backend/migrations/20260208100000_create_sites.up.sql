@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS sites (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    hosts JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Existing data belongs to the site this deployment served so far. Deployments
+-- with a different SITE_ID rename it afterwards; site_id follows via ON UPDATE CASCADE:
+--   UPDATE sites SET id = 'my-site' WHERE id = 'cc-lippstadt';
+INSERT INTO sites (id, name) VALUES ('cc-lippstadt', 'Calvary Chapel Lippstadt')
+    ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE contact_requests ADD COLUMN IF NOT EXISTS site_id TEXT NOT NULL DEFAULT 'cc-lippstadt'
+    REFERENCES sites (id) ON UPDATE CASCADE;
+ALTER TABLE contact_requests ALTER COLUMN site_id DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS idx_contact_requests_site_id ON contact_requests (site_id, created_at);
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS site_id TEXT NOT NULL DEFAULT 'cc-lippstadt'
+    REFERENCES sites (id) ON UPDATE CASCADE;
+ALTER TABLE events ALTER COLUMN site_id DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS idx_events_site_id ON events (site_id, start_time);
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS site_id TEXT NOT NULL DEFAULT 'cc-lippstadt'
+    REFERENCES sites (id) ON UPDATE CASCADE;
+ALTER TABLE api_keys ALTER COLUMN site_id DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS idx_api_keys_site_id ON api_keys (site_id);
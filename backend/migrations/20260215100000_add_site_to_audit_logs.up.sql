@@ -0,0 +1,4 @@
+-- Entries recorded before sites existed keep an empty site_id, which belongs
+-- to the default site, so their hashes stay valid
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS site_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_audit_logs_site_id ON audit_logs (site_id, id);
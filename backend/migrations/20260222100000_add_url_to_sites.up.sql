@@ -0,0 +1,4 @@
+-- The public website of each site, linked from the structured data of its
+-- events. Empty falls back to https:// and the first host, and for the
+-- default site to SITE_URL.
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS url TEXT NOT NULL DEFAULT '';
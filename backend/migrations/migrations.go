@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations into the binary, so they are
+// applied by "./main migrate up" without shipping the files alongside it.
+package migrations
+
+import "embed"
+
+// FS holds the YYYYMMDDHHMMSS_name.up.sql and .down.sql files
+//
+//go:embed *.sql
+var FS embed.FS